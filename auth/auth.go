@@ -7,10 +7,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 
 	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
 	"ec2-restart-manager/utils"
 
 	"github.com/google/uuid"
@@ -20,10 +22,37 @@ import (
 
 var oauthConfig *oauth2.Config
 var groupID string
+var adminGroupID string
+var policy *models.Policy
+
+// InitializeAuth sets up the OAuth configuration and access policy using the loaded config.
+func InitializeAuth(cfg *config.EnvConfig) error {
+	roles := make(map[string]models.Grant)
+	for name, role := range cfg.RBAC.Roles {
+		roles[name] = models.Grant{
+			Actions:            role.Actions,
+			AccountNames:       role.AccountNames,
+			EnvironmentClasses: role.EnvironmentClasses,
+			Services:           role.Services,
+			Owners:             role.Owners,
+		}
+	}
+	var err error
+	policy, err = models.NewPolicy(roles, cfg.RBAC.Groups)
+	if err != nil {
+		return fmt.Errorf("invalid rbac configuration: %w", err)
+	}
 
-// InitializeAuth sets up the OAuth configuration using the loaded config.
-func InitializeAuth(cfg *config.EnvConfig) {
 	groupID = cfg.AzureAD.GroupID
+	adminGroupID = cfg.AzureAD.AdminGroupID
+	if adminGroupID == "" {
+		log.Printf("Warning: azure_ad.admin_group_id is not set, so nobody can manage API keys")
+	}
+	tenantID = cfg.AzureAD.TenantID
+	apiAudience = cfg.AzureAD.APIAudience
+	if apiAudience == "" {
+		apiAudience = "api://" + cfg.AzureAD.ClientID
+	}
 	oauthConfig = &oauth2.Config{
 		ClientID:     cfg.AzureAD.ClientID,
 		ClientSecret: os.Getenv("AZURE_AD_CLIENT_SECRET"), // Ensure this is set as an environment variable
@@ -31,22 +60,63 @@ func InitializeAuth(cfg *config.EnvConfig) {
 		Endpoint:     microsoft.AzureADEndpoint(cfg.AzureAD.TenantID),
 		Scopes:       []string{"openid", "profile", "User.Read", "GroupMember.Read.All"},
 	}
+	return nil
+}
+
+// Session is a logged-in user
+type Session struct {
+	UserID   string // Azure AD object ID (oid) of the user, which unlike the name is unique and stable
+	UserName string
+	Admin    bool           // Member of the admin group, who may manage API keys
+	Grants   []models.Grant // Roles of the user, from their group memberships
+}
+
+// Server-side sessions by session ID, shared by concurrent requests
+var (
+	sessionsMu sync.RWMutex
+	sessions   = make(map[string]Session)
+)
+
+// NewSession stores a session and returns its ID
+func NewSession(session Session) string {
+	sessionID := uuid.NewString()
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	sessions[sessionID] = session
+	return sessionID
+}
+
+// deleteSession removes a session
+func deleteSession(sessionID string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	delete(sessions, sessionID)
 }
 
-// Session store for server-side session management (maps session ID to user name)
-var SessionStore = make(map[string]string)
+// requestSession returns the session of the session cookie, if there is one
+func requestSession(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil || cookie.Value == "" {
+		return Session{}, false
+	}
+	sessionsMu.RLock()
+	defer sessionsMu.RUnlock()
+	session, exists := sessions[cookie.Value]
+	return session, exists && session.UserName != ""
+}
 
 func PrintSessionStore() {
+    sessionsMu.RLock()
+    defer sessionsMu.RUnlock()
     log.Println("Current SessionStore contents:")
-    for sessionID, userName := range SessionStore {
-        log.Printf("SessionID: %s, UserName: %s\n", sessionID, userName)
+    for sessionID, session := range sessions {
+        log.Printf("SessionID: %s, UserName: %s\n", sessionID, session.UserName)
     }
 }
 
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_id")
-		if err != nil || cookie.Value == "" || SessionStore[cookie.Value] == "" {
+		if _, loggedIn := requestSession(r); !loggedIn {
 			// Redirect to login if the session ID is missing or invalid
 			http.Redirect(w, r, "/login", http.StatusFound)
 			return
@@ -57,6 +127,49 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AdminMiddleware only lets members of the admin group through
+func AdminMiddleware(next http.Handler) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(r) {
+			http.Redirect(w, r, "/access_denied", http.StatusFound)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// APIAuthMiddleware is the AuthMiddleware for API routes. It accepts a session cookie, an
+// Azure AD client-credentials token or an API key, and requires the caller to be allowed
+// action on at least some instances. Instead of redirecting to the login page it answers
+// with JSON 401 and 403 errors.
+func APIAuthMiddleware(action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticateRequest(r)
+		if err != nil {
+			if err != errNotAuthenticated {
+				log.Printf("Rejected API credentials: %v", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ec2-restart-manager"`)
+			writeAuthError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !principal.Can(action) {
+			writeAuthError(w, http.StatusForbidden, fmt.Sprintf("%s is not allowed to %s", principal.Name, action))
+			return
+		}
+
+		next.ServeHTTP(w, withPrincipal(r, principal))
+	})
+}
+
+// writeAuthError writes an authentication or authorization error as a JSON response
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
 
 // LoginHandler redirects users to the Azure AD login page.
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,7 +180,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
     // Delete the session from SessionStore
     if cookie, err := r.Cookie("session_id"); err == nil {
-        delete(SessionStore, cookie.Value)
+        deleteSession(cookie.Value)
     }
 
     // Clear the session_id cookie
@@ -106,8 +219,16 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    // **Check if the user is in the required group**
-	if !isUserInGroup(token) {
+	groups, err := userGroups(token)
+	if err != nil {
+		log.Printf("Failed to fetch group memberships: %v", err)
+		http.Redirect(w, r, "/access_denied", http.StatusFound)
+		return
+	}
+
+    // **Check if the user is in the required group and has at least one role**
+	grants := policy.GrantsForGroups(groups)
+	if !containsString(groups, groupID) || len(grants) == 0 {
 		// Redirect to access denied page
 		http.Redirect(w, r, "/access_denied", http.StatusFound)
 		return
@@ -122,18 +243,23 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer userInfo.Body.Close()
 
-	// Decode the user info to get the display name
+	// Decode the user info to get the object ID, the same as the oid claim, and the display name
 	var profile struct {
+		ID          string `json:"id"`
 		DisplayName string `json:"displayName"`
 	}
-	if err := json.NewDecoder(userInfo.Body).Decode(&profile); err != nil {
+	if err := json.NewDecoder(userInfo.Body).Decode(&profile); err != nil || profile.ID == "" {
 		http.Error(w, "Failed to decode user info", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate a unique session ID and store it with the user's display name
-	sessionID := uuid.NewString()
-	SessionStore[sessionID] = profile.DisplayName
+	// Generate a unique session ID and store it with the user's ID and display name
+	sessionID := NewSession(Session{
+		UserID:   profile.ID,
+		UserName: profile.DisplayName,
+		Admin:    adminGroupID != "" && containsString(groups, adminGroupID),
+		Grants:   grants,
+	})
 
 	if utils.Debug {	
 		PrintSessionStore()
@@ -153,16 +279,16 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-// isUserInGroup checks if the user is a member of the specified AD group.
-func isUserInGroup(token *oauth2.Token) bool {
+// userGroups returns the IDs of the AD groups the user is a member of.
+func userGroups(token *oauth2.Token) ([]string, error) {
 	client := oauthConfig.Client(context.Background(), token)
 	url := "https://graph.microsoft.com/v1.0/me/memberOf"
 
+	var groupIDs []string
 	for {
 		resp, err := client.Get(url)
 		if err != nil {
-			fmt.Printf("Failed to fetch group memberships: %v\n", err)
-			return false
+			return nil, fmt.Errorf("failed to fetch group memberships: %w", err)
 		}
 		defer resp.Body.Close()
 
@@ -174,15 +300,11 @@ func isUserInGroup(token *oauth2.Token) bool {
 		}
 
 		if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
-			fmt.Printf("Failed to decode group memberships response: %v\n", err)
-			return false
+			return nil, fmt.Errorf("failed to decode group memberships response: %w", err)
 		}
 
-		// Check if the user is a member of the specified group
 		for _, group := range groups.Value {
-			if group.ID == groupID {
-				return true
-			}
+			groupIDs = append(groupIDs, group.ID)
 		}
 
 		// If there's a next link, continue fetching the next page
@@ -192,7 +314,7 @@ func isUserInGroup(token *oauth2.Token) bool {
 		url = groups.NextLink
 	}
 
-	return false
+	return groupIDs, nil
 }
 
 // outputUserGroups outputs the list of group IDs the user is a member of to the console.
@@ -237,11 +359,31 @@ func outputUserGroups(token *oauth2.Token) {
 
 
 func IsUserLoggedIn(r *http.Request) bool {
-    cookie, err := r.Cookie("session_id")
-    if err != nil {
-        return false // No session cookie found
-    }
-    sessionID := cookie.Value
-    _, loggedIn := SessionStore[sessionID] // Check if session ID exists in the store
+    _, loggedIn := requestSession(r) // Check if the session ID exists in the store
     return loggedIn
-}
\ No newline at end of file
+}
+
+// IsAdmin checks if the logged-in user may manage API keys
+func IsAdmin(r *http.Request) bool {
+    session, _ := requestSession(r)
+    return session.Admin
+}
+
+// GetUserID returns the stable ID of the logged-in user or the API principal, or an empty
+// string. Unlike the display name it identifies the caller uniquely.
+func GetUserID(r *http.Request) string {
+    if principal := GetPrincipal(r); principal != nil {
+        return principal.ID
+    }
+    return ""
+}
+
+// GetUserName returns the display name of the logged-in user or the name of the API
+// principal, or an empty string
+func GetUserName(r *http.Request) string {
+    if principal := GetPrincipal(r); principal != nil {
+        return principal.Name
+    }
+    session, _ := requestSession(r)
+    return session.UserName
+}
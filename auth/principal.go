@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// Kinds of principal calling the API
+const (
+	PrincipalUser    = "user"    // Interactive user with a session cookie
+	PrincipalService = "service" // Azure AD service principal with a client-credentials token
+	PrincipalAPIKey  = "api-key" // Caller using a locally issued API key
+)
+
+// Principal is an authenticated user or API caller and what it may do
+type Principal struct {
+	ID     string // Stable identity: the Azure AD object ID of a user or service principal, or the API key ID
+	Name   string
+	Kind   string
+	Grants []models.Grant
+}
+
+// Can checks if the principal may perform action on at least some instances
+func (p *Principal) Can(action string) bool {
+	for _, grant := range p.Grants {
+		if grant.Allows(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanOn checks if the principal may perform action on instance
+func (p *Principal) CanOn(action string, instance models.EC2Instance) bool {
+	for _, grant := range p.Grants {
+		if grant.AllowsOn(action, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanUseCommand checks if the principal may run a library command on at least some instances
+func (p *Principal) CanUseCommand(command *models.CommandTemplate) bool {
+	for _, grant := range p.Grants {
+		if grant.Allows(models.ActionCommand) || (command.Role != "" && grant.Role == command.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRunCommand checks if the principal may run a library command on instance, either with
+// the command action or as a member of the command's role, in an environment it allows
+func (p *Principal) CanRunCommand(command *models.CommandTemplate, instance models.EC2Instance) bool {
+	if !command.AllowsEnvironment(instance.EnvironmentClass) {
+		return false
+	}
+	for _, grant := range p.Grants {
+		if grant.AllowsOn(models.ActionCommand, instance) ||
+			(command.Role != "" && grant.Role == command.Role && grant.Covers(instance)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanDelegate checks that the principal holds each action of grant on every instance the
+// grant's filters match, so that it cannot hand out more than it may do itself
+func (p *Principal) CanDelegate(grant models.Grant) error {
+	for _, action := range grant.Actions {
+		held := false
+		for _, own := range p.Grants {
+			if own.Allows(action) && own.Includes(grant) {
+				held = true
+				break
+			}
+		}
+		if !held {
+			return fmt.Errorf("%s may not %s on all instances the key would cover", p.Name, action)
+		}
+	}
+	return nil
+}
+
+type principalKey struct{}
+
+// withPrincipal returns a copy of r carrying the authenticated principal
+func withPrincipal(r *http.Request, principal *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// GetPrincipal returns the principal authenticated by APIAuthMiddleware or the logged-in
+// user, or nil
+func GetPrincipal(r *http.Request) *Principal {
+	if principal, ok := r.Context().Value(principalKey{}).(*Principal); ok {
+		return principal
+	}
+	return sessionPrincipal(r)
+}
+
+// Can checks if the caller may perform action on at least some instances
+func Can(r *http.Request, action string) bool {
+	return callerOrAnonymous(r).Can(action)
+}
+
+// CanOn checks if the caller may perform action on instance
+func CanOn(r *http.Request, action string, instance models.EC2Instance) bool {
+	return callerOrAnonymous(r).CanOn(action, instance)
+}
+
+// CanUseCommand checks if the caller may run a library command on at least some instances
+func CanUseCommand(r *http.Request, command *models.CommandTemplate) bool {
+	return callerOrAnonymous(r).CanUseCommand(command)
+}
+
+// CanRunCommand checks if the caller may run a library command on instance
+func CanRunCommand(r *http.Request, command *models.CommandTemplate, instance models.EC2Instance) bool {
+	return callerOrAnonymous(r).CanRunCommand(command, instance)
+}
+
+// callerOrAnonymous returns the caller, or the anonymous principal when nobody is logged in
+func callerOrAnonymous(r *http.Request) *Principal {
+	if principal := GetPrincipal(r); principal != nil {
+		return principal
+	}
+	return &Principal{Name: "anonymous", Grants: policy.AnonymousGrants()}
+}
+
+// sessionPrincipal returns the user logged in with the session cookie, or nil
+func sessionPrincipal(r *http.Request) *Principal {
+	session, loggedIn := requestSession(r)
+	if !loggedIn {
+		return nil
+	}
+	return &Principal{ID: session.UserID, Name: session.UserName, Kind: PrincipalUser, Grants: session.Grants}
+}
+
+// authenticateRequest resolves the caller from a bearer token or, failing that, the session cookie
+func authenticateRequest(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		if principal := sessionPrincipal(r); principal != nil {
+			return principal, nil
+		}
+		return nil, errNotAuthenticated
+	}
+
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" {
+		return nil, errNotAuthenticated
+	}
+
+	if strings.HasPrefix(token, models.APIKeyPrefix) {
+		key, err := models.AuthenticateAPIKey(token)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{ID: "api-key:" + key.ID, Name: "api-key:" + key.Name, Kind: PrincipalAPIKey, Grants: []models.Grant{key.Grant()}}, nil
+	}
+
+	return validateServiceToken(token)
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"testing"
+
+	"ec2-restart-manager/models"
+)
+
+var (
+	devInstance  = models.EC2Instance{ID: "i-dev", AWSAccountName: "dev", EnvironmentClass: "dev", Service: "checkout", Owner: "team-a"}
+	prodInstance = models.EC2Instance{ID: "i-prod", AWSAccountName: "prod", EnvironmentClass: "prod", Service: "checkout", Owner: "team-a"}
+)
+
+func TestPrincipalCanOn(t *testing.T) {
+	devOperator := &Principal{Name: "dev", Grants: []models.Grant{models.DefaultRoles["dev-operator"]}}
+	both := &Principal{Name: "both", Grants: []models.Grant{models.DefaultRoles["viewer"], models.DefaultRoles["dev-operator"]}}
+	nobody := &Principal{Name: "nobody"}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		action    string
+		instance  models.EC2Instance
+		want      bool
+	}{
+		{"restart in granted environment", devOperator, models.ActionRestart, devInstance, true},
+		{"restart outside granted environment", devOperator, models.ActionRestart, prodInstance, false},
+		{"read outside granted environment", devOperator, models.ActionRead, prodInstance, false},
+		{"action not granted", devOperator, models.ActionCommand, devInstance, false},
+		{"read from another role", both, models.ActionRead, prodInstance, true},
+		{"roles do not combine actions and filters", both, models.ActionRestart, prodInstance, false},
+		{"no grants", nobody, models.ActionRead, devInstance, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.principal.CanOn(test.action, test.instance); got != test.want {
+				t.Errorf("CanOn() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrincipalCanRunCommand(t *testing.T) {
+	command := &models.CommandTemplate{Name: "restart-service", Role: "service-restarter"}
+	devOnly := &models.CommandTemplate{Name: "clear-tmp", Role: "service-restarter", EnvironmentClasses: []string{"dev"}}
+	withoutRole := &models.CommandTemplate{Name: "collect-diagnostics"}
+
+	commandRunner := &Principal{Grants: []models.Grant{models.DefaultRoles["command-runner"]}}
+	roleMember := &Principal{Grants: []models.Grant{
+		{Role: "service-restarter", Actions: []string{models.ActionRead}, EnvironmentClasses: []string{"dev"}},
+	}}
+	otherRole := &Principal{Grants: []models.Grant{
+		{Role: "other", Actions: []string{models.ActionRead}},
+	}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		command   *models.CommandTemplate
+		instance  models.EC2Instance
+		want      bool
+	}{
+		{"command action", commandRunner, command, prodInstance, true},
+		{"command action, restricted environment", commandRunner, devOnly, prodInstance, false},
+		{"command action, allowed environment", commandRunner, devOnly, devInstance, true},
+		{"role member on covered instance", roleMember, command, devInstance, true},
+		{"role member beyond the role's filters", roleMember, command, prodInstance, false},
+		{"role member, command without role", roleMember, withoutRole, devInstance, false},
+		{"member of another role", otherRole, command, devInstance, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.principal.CanRunCommand(test.command, test.instance); got != test.want {
+				t.Errorf("CanRunCommand() = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if !roleMember.CanUseCommand(command) || roleMember.CanUseCommand(withoutRole) || otherRole.CanUseCommand(command) {
+		t.Error("CanUseCommand does not follow the command's role")
+	}
+	// The role bypass is for library commands only, never for raw shell
+	if roleMember.Can(models.ActionCommand) || roleMember.CanOn(models.ActionCommand, devInstance) {
+		t.Error("role member may run raw commands")
+	}
+}
+
+func TestPrincipalCanDelegate(t *testing.T) {
+	admin := &Principal{Name: "admin", Grants: []models.Grant{models.DefaultRoles["admin"]}}
+	devOperator := &Principal{Name: "dev", Grants: []models.Grant{models.DefaultRoles["dev-operator"]}}
+	split := &Principal{Name: "split", Grants: []models.Grant{
+		{Actions: []string{models.ActionRestart}, EnvironmentClasses: []string{"dev"}},
+		{Actions: []string{models.ActionRead}},
+	}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		grant     models.Grant
+		allowed   bool
+	}{
+		{"admin, every instance", admin, models.Grant{Actions: models.AllActions}, true},
+		{"same scope", devOperator, models.Grant{Actions: []string{models.ActionRestart}, EnvironmentClasses: []string{"dev", "stg"}}, true},
+		{"narrower scope", devOperator, models.Grant{Actions: []string{models.ActionRestart}, EnvironmentClasses: []string{"dev"}, Owners: []string{"team-a"}}, true},
+		{"wider environments", devOperator, models.Grant{Actions: []string{models.ActionRestart}, EnvironmentClasses: []string{"dev", "prod"}}, false},
+		{"every instance", devOperator, models.Grant{Actions: []string{models.ActionRestart}}, false},
+		{"action not held", devOperator, models.Grant{Actions: []string{models.ActionCommand}, EnvironmentClasses: []string{"dev"}}, false},
+		{"each action needs its own scope", split, models.Grant{Actions: []string{models.ActionRead, models.ActionRestart}}, false},
+		{"each action within its scope", split, models.Grant{Actions: []string{models.ActionRead, models.ActionRestart}, EnvironmentClasses: []string{"dev"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.principal.CanDelegate(test.grant)
+			if (err == nil) != test.allowed {
+				t.Errorf("CanDelegate() = %v, want allowed %v", err, test.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ec2-restart-manager/models"
+)
+
+var errNotAuthenticated = errors.New("authentication required")
+
+// Allowed clock difference when checking token lifetimes
+const tokenLeeway = 2 * time.Minute
+
+// The JWKS is refetched when a token names an unknown key, but not more often than this
+const jwksMinRefresh = 5 * time.Minute
+
+// URL of the tenant's token signing keys, with the tenant ID as %s
+var jwksEndpoint = "https://login.microsoftonline.com/%s/discovery/v2.0/keys"
+
+var (
+	tenantID    string
+	apiAudience string
+
+	jwksMutex     sync.Mutex
+	jwksKeys      map[string]*rsa.PublicKey
+	jwksFetchedAt time.Time
+)
+
+// tokenClaims are the claims of an Azure AD access token used for authorization
+type tokenClaims struct {
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	TenantID  string          `json:"tid"`
+	AppID     string          `json:"appid"` // v1 tokens
+	AZP       string          `json:"azp"`   // v2 tokens
+	ObjectID  string          `json:"oid"`   // Object ID of the service principal
+	Scope     string          `json:"scp"`   // Only present in delegated (user) tokens
+	Roles     []string        `json:"roles"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+// validateServiceToken checks an Azure AD client-credentials token against the tenant's
+// signing keys. App roles named like a policy role get that role; app roles named like an
+// action allow it on every instance.
+func validateServiceToken(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	key, err := signingKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	var claims tokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	appID := claims.AZP
+	if appID == "" {
+		appID = claims.AppID
+	}
+	var grants []models.Grant
+	for _, role := range claims.Roles {
+		if grant, exists := policy.Role(role); exists {
+			grants = append(grants, grant)
+		} else if containsString(models.AllActions, role) {
+			grants = append(grants, models.Grant{Role: role, Actions: []string{role}})
+		}
+	}
+	id := claims.ObjectID
+	if id == "" {
+		id = "app:" + appID
+	}
+	return &Principal{ID: id, Name: "app:" + appID, Kind: PrincipalService, Grants: grants}, nil
+}
+
+// checkClaims checks that a token was issued by our tenant to a service principal for this API
+// and is currently valid
+func checkClaims(claims tokenClaims, now time.Time) error {
+	if claims.TenantID != tenantID ||
+		(claims.Issuer != "https://login.microsoftonline.com/"+tenantID+"/v2.0" &&
+			claims.Issuer != "https://sts.windows.net/"+tenantID+"/") {
+		return fmt.Errorf("token was not issued by tenant %s", tenantID)
+	}
+
+	var audiences []string
+	if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		var audience string
+		if err := json.Unmarshal(claims.Audience, &audience); err != nil {
+			return fmt.Errorf("malformed token audience")
+		}
+		audiences = []string{audience}
+	}
+	if !containsString(audiences, apiAudience) && !containsString(audiences, oauthConfig.ClientID) {
+		return fmt.Errorf("token is not meant for this API")
+	}
+
+	if claims.Scope != "" {
+		return fmt.Errorf("delegated user tokens are not accepted, use a client-credentials token")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(tokenLeeway)) {
+		return fmt.Errorf("token has expired")
+	}
+	if claims.NotBefore != 0 && now.Add(tokenLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	return nil
+}
+
+// signingKey returns the tenant's public key with the given ID, refreshing the JWKS
+// when the key is not known yet
+func signingKey(kid string) (*rsa.PublicKey, error) {
+	jwksMutex.Lock()
+	defer jwksMutex.Unlock()
+
+	if key, ok := jwksKeys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(jwksFetchedAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown token signing key %q", kid)
+	}
+
+	keys, err := fetchJWKS()
+	if err != nil {
+		return nil, err
+	}
+	jwksKeys = keys
+	jwksFetchedAt = time.Now()
+
+	if key, ok := jwksKeys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown token signing key %q", kid)
+}
+
+// fetchJWKS downloads the tenant's token signing keys
+func fetchJWKS() (map[string]*rsa.PublicKey, error) {
+	url := fmt.Sprintf(jwksEndpoint, tenantID)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing keys: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// decodeTokenPart decodes a base64url encoded JSON part of a token into v
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// containsString checks if a slice contains a string
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ec2-restart-manager/config"
+)
+
+const (
+	testTenant   = "11111111-1111-1111-1111-111111111111"
+	testClientID = "22222222-2222-2222-2222-222222222222"
+	testKid      = "test-key"
+)
+
+// setupServiceTokens configures auth for testTenant and serves a JWKS holding the public
+// half of the returned key, counting how often it is fetched
+func setupServiceTokens(t *testing.T) (*rsa.PrivateKey, *int) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.EnvConfig{}
+	cfg.AzureAD.TenantID = testTenant
+	cfg.AzureAD.ClientID = testClientID
+	if err := InitializeAuth(cfg); err != nil {
+		t.Fatal(err)
+	}
+	previousEndpoint := jwksEndpoint
+	jwksEndpoint = server.URL + "/%s"
+	jwksKeys = nil
+	jwksFetchedAt = time.Time{}
+	t.Cleanup(func() { jwksEndpoint = previousEndpoint })
+	return key, &fetches
+}
+
+// validClaims are the claims of a token our tenant issues to a service principal
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   "https://login.microsoftonline.com/" + testTenant + "/v2.0",
+		"aud":   "api://" + testClientID,
+		"tid":   testTenant,
+		"azp":   "pipeline",
+		"oid":   "33333333-3333-3333-3333-333333333333",
+		"roles": []string{"viewer", "restart"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+	}
+}
+
+// encodePart encodes a token header or claims
+func encodePart(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signRS256 returns a token signed with key
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodePart(t, map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + encodePart(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestValidateServiceToken(t *testing.T) {
+	key, _ := setupServiceTokens(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	unsigned := func(alg string) string {
+		return encodePart(t, map[string]string{"alg": alg, "kid": testKid}) + "." + encodePart(t, validClaims()) + "."
+	}
+	hs256 := func() string {
+		// Signed with the public key as HMAC secret, the classic algorithm confusion attack
+		signed := encodePart(t, map[string]string{"alg": "HS256", "kid": testKid}) + "." + encodePart(t, validClaims())
+		mac := hmac.New(sha256.New, key.N.Bytes())
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	tampered := func() string {
+		parts := strings.Split(signRS256(t, key, testKid, validClaims()), ".")
+		parts[1] = encodePart(t, withClaim("roles", []string{"admin"}))
+		return strings.Join(parts, ".")
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signRS256(t, key, testKid, validClaims()), ""},
+		{"v1 issuer and audience list", signRS256(t, key, testKid, withClaim("iss", "https://sts.windows.net/"+testTenant+"/")), ""},
+		{"client ID audience", signRS256(t, key, testKid, withClaim("aud", []string{testClientID})), ""},
+		{"expired", signRS256(t, key, testKid, withClaim("exp", time.Now().Add(-time.Hour).Unix())), "expired"},
+		{"expired within leeway", signRS256(t, key, testKid, withClaim("exp", time.Now().Add(-time.Minute).Unix())), ""},
+		{"not valid yet", signRS256(t, key, testKid, withClaim("nbf", time.Now().Add(time.Hour).Unix())), "not valid yet"},
+		{"wrong audience", signRS256(t, key, testKid, withClaim("aud", "api://someone-else")), "not meant for this API"},
+		{"missing audience", signRS256(t, key, testKid, withClaim("aud", nil)), "audience"},
+		{"wrong issuer", signRS256(t, key, testKid, withClaim("iss", "https://login.microsoftonline.com/other/v2.0")), "not issued by tenant"},
+		{"wrong tenant", signRS256(t, key, testKid, withClaim("tid", "other")), "not issued by tenant"},
+		{"delegated user token", signRS256(t, key, testKid, withClaim("scp", "user_impersonation")), "delegated"},
+		{"alg none", unsigned("none"), "unsupported token algorithm"},
+		{"alg HS256", hs256(), "unsupported token algorithm"},
+		{"signed by another key", signRS256(t, otherKey, testKid, validClaims()), "invalid token signature"},
+		{"tampered claims", tampered(), "invalid token signature"},
+		{"unknown kid", signRS256(t, otherKey, "rotated-away", validClaims()), "unknown token signing key"},
+		{"malformed", "not-a-token", "malformed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := validateServiceToken(test.token)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if principal.Kind != PrincipalService || principal.ID != "33333333-3333-3333-3333-333333333333" || !principal.Can("read") || !principal.Can("restart") || principal.Can("command") {
+					t.Errorf("unexpected principal %+v", principal)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRefreshIsThrottled(t *testing.T) {
+	key, fetches := setupServiceTokens(t)
+
+	if _, err := validateServiceToken(signRS256(t, key, testKid, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := validateServiceToken(signRS256(t, key, "unknown", validClaims())); err == nil {
+			t.Fatal("token with unknown kid was accepted")
+		}
+	}
+	if *fetches != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", *fetches)
+	}
+
+	// A rotated key is picked up once the minimum refresh interval has passed
+	jwksFetchedAt = time.Now().Add(-jwksMinRefresh)
+	if _, err := validateServiceToken(signRS256(t, key, "unknown", validClaims())); err == nil {
+		t.Fatal("token with unknown kid was accepted")
+	}
+	if *fetches != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", *fetches)
+	}
+}
@@ -2,13 +2,33 @@ package aws
 
 import (
     "context"
+    "errors"
     "fmt"
     "log"
+    "time"
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/ec2"
+    "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
+// ErrHealthTimeout is returned when an instance does not pass its status checks in time
+var ErrHealthTimeout = errors.New("timed out waiting for status checks")
+
+// InstanceHealth describes the EC2 state and status check results of an instance
+type InstanceHealth struct {
+    State          string // e.g., "running", "stopping", "pending"
+    SystemStatus   string // e.g., "ok", "initializing", "impaired"
+    InstanceStatus string // e.g., "ok", "initializing", "impaired"
+}
+
+// Healthy reports whether the instance is running and both status checks pass
+func (h InstanceHealth) Healthy() bool {
+    return h.State == string(types.InstanceStateNameRunning) &&
+        h.SystemStatus == string(types.SummaryStatusOk) &&
+        h.InstanceStatus == string(types.SummaryStatusOk)
+}
+
 // NewEC2Client creates an EC2 client using the provided AWS Config and region
 func NewEC2Client(cfg aws.Config, region string) (*ec2.Client, error) {
     // Override the region in the provided AWS Config
@@ -37,6 +57,155 @@ func RestartEC2Instance(ec2Client *ec2.Client, instanceID string) error {
     return nil
 }
 
+// GetInstanceHealth retrieves the current state and status checks of an EC2 instance
+func GetInstanceHealth(ec2Client *ec2.Client, instanceID string) (InstanceHealth, error) {
+    input := &ec2.DescribeInstanceStatusInput{
+        InstanceIds:         []string{instanceID},
+        IncludeAllInstances: aws.Bool(true), // Also report instances that are not running
+    }
+
+    output, err := ec2Client.DescribeInstanceStatus(context.Background(), input)
+    if err != nil {
+        return InstanceHealth{}, fmt.Errorf("failed to describe status of instance %s: %w", instanceID, err)
+    }
+    if len(output.InstanceStatuses) == 0 {
+        return InstanceHealth{}, fmt.Errorf("no status returned for instance %s", instanceID)
+    }
+
+    status := output.InstanceStatuses[0]
+    health := InstanceHealth{}
+    if status.InstanceState != nil {
+        health.State = string(status.InstanceState.Name)
+    }
+    if status.SystemStatus != nil {
+        health.SystemStatus = string(status.SystemStatus.Status)
+    }
+    if status.InstanceStatus != nil {
+        health.InstanceStatus = string(status.InstanceStatus.Status)
+    }
+    return health, nil
+}
+
+// WaitForInstanceHealthy polls an instance until it is running with both status checks
+// reporting ok, calling onChange whenever the observed health changes. Checks that still
+// report ok from before a reboot are ignored until settle has elapsed.
+func WaitForInstanceHealthy(ec2Client *ec2.Client, instanceID string, settle, timeout time.Duration, onChange func(InstanceHealth)) (InstanceHealth, error) {
+    start := time.Now()
+    deadline := start.Add(timeout)
+    var last InstanceHealth
+    transitioned := false
+
+    for {
+        health, err := GetInstanceHealth(ec2Client, instanceID)
+        if err != nil {
+            return last, err
+        }
+        if health != last {
+            onChange(health)
+            last = health
+        }
+        if !health.Healthy() {
+            transitioned = true
+        } else if transitioned || time.Since(start) >= settle {
+            log.Printf("Instance %s passed status checks after %s", instanceID, time.Since(start).Round(time.Second))
+            return health, nil
+        }
+
+        if time.Now().After(deadline) {
+            return last, fmt.Errorf("instance %s after %s: %w", instanceID, timeout, ErrHealthTimeout)
+        }
+        time.Sleep(15 * time.Second)
+    }
+}
+
+// DescribeEC2Instance retrieves the full description of a single EC2 instance
+func DescribeEC2Instance(ec2Client *ec2.Client, instanceID string) (types.Instance, error) {
+    output, err := ec2Client.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+        InstanceIds: []string{instanceID},
+    })
+    if err != nil {
+        return types.Instance{}, fmt.Errorf("failed to describe instance %s: %w", instanceID, err)
+    }
+
+    for _, reservation := range output.Reservations {
+        for _, instance := range reservation.Instances {
+            return instance, nil
+        }
+    }
+    return types.Instance{}, fmt.Errorf("instance %s not found", instanceID)
+}
+
+// HasElasticIP reports whether an Elastic IP address is associated with the instance
+func HasElasticIP(ec2Client *ec2.Client, instanceID string) (bool, error) {
+    output, err := ec2Client.DescribeAddresses(context.Background(), &ec2.DescribeAddressesInput{
+        Filters: []types.Filter{
+            {Name: aws.String("instance-id"), Values: []string{instanceID}},
+        },
+    })
+    if err != nil {
+        return false, fmt.Errorf("failed to describe addresses for instance %s: %w", instanceID, err)
+    }
+    return len(output.Addresses) > 0, nil
+}
+
+// StopEC2Instance stops an EC2 instance and waits until it reaches the stopped state
+func StopEC2Instance(ec2Client *ec2.Client, instanceID string, timeout time.Duration) error {
+    _, err := ec2Client.StopInstances(context.Background(), &ec2.StopInstancesInput{
+        InstanceIds: []string{instanceID},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to stop instance %s: %w", instanceID, err)
+    }
+
+    // Wait for the instance to be fully stopped so that it can be started on new hardware
+    waiter := ec2.NewInstanceStoppedWaiter(ec2Client)
+    err = waiter.Wait(context.Background(), &ec2.DescribeInstancesInput{
+        InstanceIds: []string{instanceID},
+    }, timeout)
+    if err != nil {
+        return fmt.Errorf("instance %s did not reach stopped state: %w", instanceID, err)
+    }
+
+    log.Printf("Instance %s stopped", instanceID)
+    return nil
+}
+
+// StartEC2Instance starts a stopped EC2 instance
+func StartEC2Instance(ec2Client *ec2.Client, instanceID string) error {
+    _, err := ec2Client.StartInstances(context.Background(), &ec2.StartInstancesInput{
+        InstanceIds: []string{instanceID},
+    })
+    if err != nil {
+        return fmt.Errorf("failed to start instance %s: %w", instanceID, err)
+    }
+
+    log.Printf("Instance %s start requested", instanceID)
+    return nil
+}
+
+// DescribeRunningInstances retrieves all running instances in the client's region,
+// following pagination
+func DescribeRunningInstances(ec2Client *ec2.Client) ([]types.Instance, error) {
+    input := &ec2.DescribeInstancesInput{
+        Filters: []types.Filter{
+            {Name: aws.String("instance-state-name"), Values: []string{string(types.InstanceStateNameRunning)}},
+        },
+    }
+
+    var instances []types.Instance
+    paginator := ec2.NewDescribeInstancesPaginator(ec2Client, input)
+    for paginator.HasMorePages() {
+        page, err := paginator.NextPage(context.Background())
+        if err != nil {
+            return nil, fmt.Errorf("failed to describe instances: %w", err)
+        }
+        for _, reservation := range page.Reservations {
+            instances = append(instances, reservation.Instances...)
+        }
+    }
+    return instances, nil
+}
+
 // ListInstances retrieves and outputs the list of instance IDs available to the assumed role in the specified region
 func ListInstances(ec2Client *ec2.Client) error {
     input := &ec2.DescribeInstancesInput{}
@@ -2,10 +2,14 @@
 package aws
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -23,6 +27,11 @@ func SetupS3Client() {
 
 // GetCSVFromS3 retrieves a CSV file from an S3 bucket
 func GetCSVFromS3(bucket, key string) ([]byte, error) {
+	return GetObjectFromS3(bucket, key)
+}
+
+// GetObjectFromS3 retrieves the content of an object from an S3 bucket
+func GetObjectFromS3(bucket, key string) ([]byte, error) {
 	output, err := S3Client.GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
@@ -38,3 +47,81 @@ func GetCSVFromS3(bucket, key string) ([]byte, error) {
 	}
 	return content, nil
 }
+
+// S3Object is the content and version of an S3 object
+type S3Object struct {
+	Content   []byte
+	ETag      string
+	VersionID string // Empty unless the bucket is versioned
+}
+
+// ErrNotModified is returned by GetObjectIfChanged when the object still has the given ETag
+var ErrNotModified = errors.New("object not modified")
+
+// GetObjectIfChanged retrieves an object from an S3 bucket unless its ETag still matches etag,
+// in which case ErrNotModified is returned without downloading it
+func GetObjectIfChanged(bucket, key, etag string) (S3Object, error) {
+	input := &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if etag != "" {
+		input.IfNoneMatch = &etag
+	}
+
+	output, err := S3Client.GetObject(context.Background(), input)
+	if err != nil {
+		var responseErr *awshttp.ResponseError
+		if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotModified {
+			return S3Object{}, ErrNotModified
+		}
+		return S3Object{}, fmt.Errorf("failed to get object from S3 bucket '%s' with key '%s': %w", bucket, key, err)
+	}
+	defer output.Body.Close()
+
+	content, err := io.ReadAll(output.Body)
+	if err != nil {
+		return S3Object{}, fmt.Errorf("failed to read object body from S3 bucket '%s' with key '%s': %w", bucket, key, err)
+	}
+
+	object := S3Object{Content: content}
+	if output.ETag != nil {
+		object.ETag = *output.ETag
+	}
+	if output.VersionId != nil {
+		object.VersionID = *output.VersionId
+	}
+	return object, nil
+}
+
+// PutObjectToS3 uploads content to an S3 bucket under the given key
+func PutObjectToS3(bucket, key string, content []byte) error {
+	_, err := S3Client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(content),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object to S3 bucket '%s' with key '%s': %w", bucket, key, err)
+	}
+	return nil
+}
+
+// ListS3Keys lists all object keys in an S3 bucket that start with the given prefix
+func ListS3Keys(bucket, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(S3Client, &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects in S3 bucket '%s' with prefix '%s': %w", bucket, prefix, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, *object.Key)
+		}
+	}
+	return keys, nil
+}
@@ -5,6 +5,10 @@ import (
     "context"
     "fmt"
     "log"
+    "path"
+    "sort"
+    "strings"
+    "time"
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -21,41 +25,270 @@ func NewSSMClient(cfg aws.Config, region string) (*ssm.Client, error) {
     return ssmClient, nil
 }
 
-// ExecuteSSMCommand runs a command on an EC2 instance using SSM Run Command
-func ExecuteSSMCommand(ssmClient *ssm.Client, instanceID string, command string, commandName string) (string, error) {
+// Instances SSM accepts in the InstanceIds of one SendCommand call
+const MaxCommandInstances = 50
+
+// Document run by SSMCommand unless another is given
+const ShellScriptDocument = "AWS-RunShellScript"
+
+// SSMCommand is a shell command, or another Command document, sent to many instances at once
+type SSMCommand struct {
+    InstanceIDs    []string
+    Command        string              // Shell command of AWS-RunShellScript
+    DocumentName   string              // Command document to run, defaults to AWS-RunShellScript
+    Parameters     map[string][]string // Document parameters, defaulting to Command as the commands parameter
+    Comment        string
+    MaxConcurrency string // Instances running the command at once, e.g. "10" or "25%"
+    MaxErrors      string // Failed instances after which the command is not sent to the rest, e.g. "0" or "10%"
+    OutputS3Bucket string // Bucket the instances write their full output to, none if empty
+    OutputS3Prefix string // Key prefix of the output, followed by <command ID>/<instance ID>/
+}
+
+// CommandInvocation is the status of a command on one of its instances
+type CommandInvocation struct {
+    InstanceID   string
+    Status       string
+    Output       string    // Standard output, truncated by SSM
+    ResponseCode int       // Exit code of the command, -1 until it has run
+    StartedAt    time.Time // Zero until the command starts on the instance
+    EndedAt      time.Time // Zero until the command ends on the instance
+    PluginNames  []string  // Steps of the document, needed to fetch the output of multi-step documents
+}
+
+// SendSSMCommand runs a command on up to MaxCommandInstances instances using SSM Run Command
+func SendSSMCommand(ssmClient *ssm.Client, command SSMCommand) (string, error) {
+    documentName := command.DocumentName
+    if documentName == "" {
+        documentName = ShellScriptDocument
+    }
+    parameters := command.Parameters
+    if parameters == nil {
+        parameters = map[string][]string{
+            "commands": {command.Command},
+        }
+    }
     input := &ssm.SendCommandInput{
-        InstanceIds: []string{instanceID},
-        DocumentName: aws.String("AWS-RunShellScript"),
-        Parameters: map[string][]string{
-            "commands": {command},
-        },
-        Comment: aws.String(commandName),
+        InstanceIds: command.InstanceIDs,
+        DocumentName: aws.String(documentName),
+        Parameters: parameters,
+        Comment: aws.String(command.Comment),
+    }
+    if command.MaxConcurrency != "" {
+        input.MaxConcurrency = aws.String(command.MaxConcurrency)
+    }
+    if command.MaxErrors != "" {
+        input.MaxErrors = aws.String(command.MaxErrors)
+    }
+    if command.OutputS3Bucket != "" {
+        input.OutputS3BucketName = aws.String(command.OutputS3Bucket)
+        input.OutputS3KeyPrefix = aws.String(command.OutputS3Prefix)
     }
 
     output, err := ssmClient.SendCommand(context.Background(), input)
     if err != nil {
-        return "", fmt.Errorf("failed to execute command on instance %s: %w", instanceID, err)
+        return "", fmt.Errorf("failed to send command to %d instances: %w", len(command.InstanceIDs), err)
     }
 
-    log.Printf("Command execution initiated on instance %s, command ID: %s", 
-        instanceID, *output.Command.CommandId)
+    log.Printf("Command sent to %d instances, command ID: %s", 
+        len(command.InstanceIDs), *output.Command.CommandId)
     
     return *output.Command.CommandId, nil
 }
 
-// GetCommandStatus retrieves the status of a command execution
-func GetCommandStatus(ssmClient *ssm.Client, commandID string, instanceID string) (string, string, error) {
+// ListCommandInvocations retrieves the status and output of a command on each of its instances.
+// Instances the command has not been sent to yet may be missing.
+func ListCommandInvocations(ssmClient *ssm.Client, commandID string) ([]CommandInvocation, error) {
+    var invocations []CommandInvocation
+    paginator := ssm.NewListCommandInvocationsPaginator(ssmClient, &ssm.ListCommandInvocationsInput{
+        CommandId: aws.String(commandID),
+        Details:   true,
+    })
+    for paginator.HasMorePages() {
+        page, err := paginator.NextPage(context.Background())
+        if err != nil {
+            return nil, fmt.Errorf("failed to list invocations of command %s: %w", commandID, err)
+        }
+        for _, invocation := range page.CommandInvocations {
+            result := CommandInvocation{
+                InstanceID:   aws.ToString(invocation.InstanceId),
+                Status:       string(invocation.Status),
+                ResponseCode: -1,
+            }
+            for _, plugin := range invocation.CommandPlugins {
+                result.PluginNames = append(result.PluginNames, aws.ToString(plugin.Name))
+                result.Output += aws.ToString(plugin.Output)
+                if plugin.ResponseStartDateTime != nil && result.StartedAt.IsZero() {
+                    result.StartedAt = *plugin.ResponseStartDateTime
+                }
+                if plugin.ResponseFinishDateTime != nil {
+                    result.EndedAt = *plugin.ResponseFinishDateTime
+                    result.ResponseCode = int(plugin.ResponseCode)
+                }
+            }
+            invocations = append(invocations, result)
+        }
+    }
+    return invocations, nil
+}
+
+// CancelSSMCommand stops a command on some of its instances, or on all of them if instanceIDs is empty
+func CancelSSMCommand(ssmClient *ssm.Client, commandID string, instanceIDs []string) error {
+    _, err := ssmClient.CancelCommand(context.Background(), &ssm.CancelCommandInput{
+        CommandId:   aws.String(commandID),
+        InstanceIds: instanceIDs,
+    })
+    if err != nil {
+        return fmt.Errorf("failed to cancel command %s: %w", commandID, err)
+    }
+
+    log.Printf("Cancellation requested for command %s on %d instances", commandID, len(instanceIDs))
+    return nil
+}
+
+// GetCommandOutput retrieves the standard output and error of a command on an instance, as
+// returned by SSM, which truncates them to 24,000 and 8,000 characters per step. The output of
+// documents with several steps is fetched step by step, each headed by the step name.
+func GetCommandOutput(ssmClient *ssm.Client, commandID string, instanceID string, pluginNames []string) (string, string, error) {
+    if len(pluginNames) < 2 {
+        return getCommandPluginOutput(ssmClient, commandID, instanceID, "")
+    }
+
+    var stdout, stderr strings.Builder
+    for _, pluginName := range pluginNames {
+        pluginStdout, pluginStderr, err := getCommandPluginOutput(ssmClient, commandID, instanceID, pluginName)
+        if err != nil {
+            return "", "", err
+        }
+        if pluginStdout != "" {
+            fmt.Fprintf(&stdout, "--- %s ---\n%s\n", pluginName, pluginStdout)
+        }
+        if pluginStderr != "" {
+            fmt.Fprintf(&stderr, "--- %s ---\n%s\n", pluginName, pluginStderr)
+        }
+    }
+    return stdout.String(), stderr.String(), nil
+}
+
+// getCommandPluginOutput retrieves the output of one step of a command on an instance; the step
+// may be left empty for documents with a single step
+func getCommandPluginOutput(ssmClient *ssm.Client, commandID, instanceID, pluginName string) (string, string, error) {
     input := &ssm.GetCommandInvocationInput{
         CommandId: aws.String(commandID),
         InstanceId: aws.String(instanceID),
     }
+    if pluginName != "" {
+        input.PluginName = aws.String(pluginName)
+    }
 
     output, err := ssmClient.GetCommandInvocation(context.Background(), input)
     if err != nil {
-        return "", "", fmt.Errorf("failed to retrieve command status: %w", err)
+        return "", "", fmt.Errorf("failed to retrieve output of command %s on instance %s: %w", commandID, instanceID, err)
     }
 
-    return string(output.Status), *output.StandardOutputContent, nil
+    return aws.ToString(output.StandardOutputContent), aws.ToString(output.StandardErrorContent), nil
+}
+
+// GetCommandOutputFromS3 retrieves the full stdout or stderr a command wrote below prefix in
+// its S3 output location, concatenating the output of each step in key order. It returns
+// nil if the command wrote nothing.
+func GetCommandOutputFromS3(bucket, prefix, stream string) ([]byte, error) {
+    keys, err := ListS3Keys(bucket, prefix)
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(keys)
+
+    var content []byte
+    for _, key := range keys {
+        if path.Base(key) != stream {
+            continue
+        }
+        object, err := GetObjectFromS3(bucket, key)
+        if err != nil {
+            return nil, err
+        }
+        content = append(content, object...)
+    }
+    return content, nil
+}
+
+// AutomationStep is the progress of one step of an Automation execution
+type AutomationStep struct {
+    Name           string
+    Action         string    // e.g. aws:changeInstanceState
+    Status         string
+    StartedAt      time.Time // Zero until the step starts
+    EndedAt        time.Time // Zero until the step ends
+    FailureMessage string
+}
+
+// AutomationExecution is the status of an Automation execution and of each of its steps
+type AutomationExecution struct {
+    ID             string
+    Status         string
+    StartedAt      time.Time
+    EndedAt        time.Time
+    FailureMessage string
+    Outputs        map[string][]string
+    Steps          []AutomationStep
+}
+
+// StartAutomation starts an execution of an Automation document, returning its execution ID
+func StartAutomation(ssmClient *ssm.Client, documentName string, parameters map[string][]string) (string, error) {
+    output, err := ssmClient.StartAutomationExecution(context.Background(), &ssm.StartAutomationExecutionInput{
+        DocumentName: aws.String(documentName),
+        Parameters:   parameters,
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to start automation %s: %w", documentName, err)
+    }
+
+    log.Printf("Automation %s started, execution ID: %s", documentName, aws.ToString(output.AutomationExecutionId))
+    return aws.ToString(output.AutomationExecutionId), nil
+}
+
+// GetAutomation retrieves the status of an Automation execution and its steps
+func GetAutomation(ssmClient *ssm.Client, executionID string) (AutomationExecution, error) {
+    output, err := ssmClient.GetAutomationExecution(context.Background(), &ssm.GetAutomationExecutionInput{
+        AutomationExecutionId: aws.String(executionID),
+    })
+    if err != nil {
+        return AutomationExecution{}, fmt.Errorf("failed to get automation execution %s: %w", executionID, err)
+    }
+
+    execution := output.AutomationExecution
+    result := AutomationExecution{
+        ID:             executionID,
+        Status:         string(execution.AutomationExecutionStatus),
+        StartedAt:      aws.ToTime(execution.ExecutionStartTime),
+        EndedAt:        aws.ToTime(execution.ExecutionEndTime),
+        FailureMessage: aws.ToString(execution.FailureMessage),
+        Outputs:        execution.Outputs,
+    }
+    for _, step := range execution.StepExecutions {
+        result.Steps = append(result.Steps, AutomationStep{
+            Name:           aws.ToString(step.StepName),
+            Action:         aws.ToString(step.Action),
+            Status:         string(step.StepStatus),
+            StartedAt:      aws.ToTime(step.ExecutionStartTime),
+            EndedAt:        aws.ToTime(step.ExecutionEndTime),
+            FailureMessage: aws.ToString(step.FailureMessage),
+        })
+    }
+    return result, nil
+}
+
+// StopAutomation cancels an Automation execution
+func StopAutomation(ssmClient *ssm.Client, executionID string) error {
+    _, err := ssmClient.StopAutomationExecution(context.Background(), &ssm.StopAutomationExecutionInput{
+        AutomationExecutionId: aws.String(executionID),
+    })
+    if err != nil {
+        return fmt.Errorf("failed to stop automation execution %s: %w", executionID, err)
+    }
+
+    log.Printf("Cancellation requested for automation execution %s", executionID)
+    return nil
 }
 
 // GetParameter retrieves a parameter value from AWS SSM Parameter Store
@@ -90,3 +323,34 @@ func PutParameter(ssmClient *ssm.Client, name string, value string) error {
 
     return nil
 }
+
+// GetParametersByPath retrieves all parameters below a path in AWS SSM Parameter Store,
+// keyed by parameter name
+func GetParametersByPath(ssmClient *ssm.Client, path string) (map[string]string, error) {
+    parameters := make(map[string]string)
+    paginator := ssm.NewGetParametersByPathPaginator(ssmClient, &ssm.GetParametersByPathInput{
+        Path:           aws.String(path),
+        WithDecryption: aws.Bool(true),
+    })
+    for paginator.HasMorePages() {
+        page, err := paginator.NextPage(context.Background())
+        if err != nil {
+            return nil, fmt.Errorf("failed to get parameters below %s: %w", path, err)
+        }
+        for _, parameter := range page.Parameters {
+            parameters[*parameter.Name] = *parameter.Value
+        }
+    }
+    return parameters, nil
+}
+
+// DeleteParameter removes a parameter from AWS SSM Parameter Store
+func DeleteParameter(ssmClient *ssm.Client, name string) error {
+    _, err := ssmClient.DeleteParameter(context.Background(), &ssm.DeleteParameterInput{
+        Name: aws.String(name),
+    })
+    if err != nil {
+        return fmt.Errorf("failed to delete parameter %s: %w", name, err)
+    }
+    return nil
+}
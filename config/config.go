@@ -13,18 +13,159 @@ type S3Config struct {
 }
 
 type AzureADConfig struct {
-	TenantID    string `yaml:"tenant_id"`
-	ClientID    string `yaml:"client_id"`
-	RedirectURL string `yaml:"redirect_url"`
-	GroupID     string `yaml:"group_id"`
+	TenantID     string `yaml:"tenant_id"`
+	ClientID     string `yaml:"client_id"`
+	RedirectURL  string `yaml:"redirect_url"`
+	GroupID      string `yaml:"group_id"`
+	AdminGroupID string `yaml:"admin_group_id"` // Members may manage API keys; empty means nobody
+	APIAudience  string `yaml:"api_audience"`   // Audience of client-credentials tokens, defaults to api://<client_id>
+}
+
+// RestartConfig controls how restarts are tracked after the reboot is requested
+type RestartConfig struct {
+	HealthTimeoutMinutes int `yaml:"health_timeout_minutes"` // How long to wait for status checks to pass
+}
+
+// CommandConfig controls how SSM commands roll out over the instances of an account and region
+type CommandConfig struct {
+	MaxConcurrency string                  `yaml:"max_concurrency"` // Instances running a command at once, e.g. "10" or "25%"; defaults to 50
+	MaxErrors      string                  `yaml:"max_errors"`      // Failures after which the rest are skipped, e.g. "0" or "10%"; defaults to 100%
+	OutputBucket   string                  `yaml:"output_bucket"`   // Bucket receiving the full stdout and stderr of commands, none if empty
+	OutputPrefix   string                  `yaml:"output_prefix"`   // Key prefix in the output bucket, defaults to command-output
+	LibrarySource  string                  `yaml:"library_source"`  // "config" (default) or "ssm" (one YAML parameter per command below /ec2-restart-manager/<env>/commands)
+	Library        []CommandTemplateConfig `yaml:"library"`         // Added to, or overriding, the built-in library commands
+	Documents      []SSMDocumentConfig     `yaml:"documents"`       // Added to, or overriding, the built-in SSM documents operators may run
+}
+
+// SSMDocumentConfig is an SSM Command or Automation document operators may run on instances
+type SSMDocumentConfig struct {
+	Name            string   `yaml:"name"` // Document name, or ARN of a document shared from another account
+	Description     string   `yaml:"description"`
+	Type            string   `yaml:"type"`             // "command" (default) or "automation"
+	TargetParameter string   `yaml:"target_parameter"` // Automation parameter set to the instance ID, defaults to InstanceId
+	Action          string   `yaml:"action"`           // Action needed on the instances, defaults to command
+	Parameters      []string `yaml:"parameters"`       // Parameters operators may set, none by default
+}
+
+// CommandParameterConfig is a typed parameter of a library command
+type CommandParameterConfig struct {
+	Name        string   `yaml:"name"`
+	Label       string   `yaml:"label"`
+	Description string   `yaml:"description"`
+	Type        string   `yaml:"type"` // "string" (default), "integer", "boolean" or "choice"
+	Required    bool     `yaml:"required"`
+	Default     string   `yaml:"default"`
+	Pattern     string   `yaml:"pattern"` // Regular expression a string must match in full
+	Min         *int     `yaml:"min"`     // Bounds of an integer
+	Max         *int     `yaml:"max"`
+	Options     []string `yaml:"options"` // Values of a choice
+}
+
+// CommandTemplateConfig is an approved command of the command library
+type CommandTemplateConfig struct {
+	Name               string                   `yaml:"name"`
+	Description        string                   `yaml:"description"`
+	Template           string                   `yaml:"template"` // Shell command, with parameters as {{ .name }}
+	Parameters         []CommandParameterConfig `yaml:"parameters"`
+	EnvironmentClasses []string                 `yaml:"environment_classes"` // Empty allows every environment class
+	Role               string                   `yaml:"role"`                // Role allowed to run it without the command action
+}
+
+// StorageConfig controls where job history is persisted
+type StorageConfig struct {
+	Path string `yaml:"path"` // BoltDB file holding jobs, defaults to data/ec2-restart-manager.db
+}
+
+// AuditConfig selects where the audit trail is written
+type AuditConfig struct {
+	Type   string `yaml:"type"`   // "file" (default) or "s3"
+	Path   string `yaml:"path"`   // JSONL file for the file store, defaults to data/audit.jsonl
+	Bucket string `yaml:"bucket"` // Bucket for the s3 store
+	Prefix string `yaml:"prefix"` // Key prefix for the s3 store, defaults to audit
+}
+
+// ReportConfig controls the reports
+type ReportConfig struct {
+	UptimeThresholdDays int `yaml:"uptime_threshold_days"` // Instances up for longer are listed by the uptime report, defaults to 90
+}
+
+// ViewsConfig selects where saved views are stored
+type ViewsConfig struct {
+	Store string `yaml:"store"` // "local" (default, the job store) or "ssm" (Parameter Store below /ec2-restart-manager/<env>/views)
+}
+
+// EC2AccountConfig is an AWS account scanned by the ec2 inventory source
+type EC2AccountConfig struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"` // Shown as the AWS account name
+}
+
+// EC2InventoryConfig controls live discovery of instances with DescribeInstances
+type EC2InventoryConfig struct {
+	RoleName    string             `yaml:"role_name"` // Role assumed in each account, defaults to ec2-restart-manager-restarter
+	Accounts    []EC2AccountConfig `yaml:"accounts"`
+	Regions     []string           `yaml:"regions"`
+	Concurrency int                `yaml:"concurrency"` // Account/region pairs scanned at once, defaults to 10
+	Tags        map[string]string  `yaml:"tags"`        // Instance field to tag key, e.g. service: Service
+}
+
+// MappingInventoryConfig controls how the rows of an s3 inventory export become instances
+type MappingInventoryConfig struct {
+	Columns map[string]string `yaml:"columns"` // Instance field to column name, e.g. environment_class: EnvironmentClass
+	States  []string          `yaml:"states"`  // States of the rows to keep, defaults to running
+}
+
+// InventorySourceConfig is one of several inventory sources
+type InventorySourceConfig struct {
+	Name    string                 `yaml:"name"`   // Shown as the source of its instances
+	Type    string                 `yaml:"type"`   // "s3" (default) or "ec2"
+	Format  string                 `yaml:"format"` // Format of the s3 export, "csv", "jsonl" or "parquet"; defaults to the key extension
+	Bucket  string                 `yaml:"bucket"`
+	Key     string                 `yaml:"key"`
+	Mapping MappingInventoryConfig `yaml:"mapping"`
+	EC2     EC2InventoryConfig     `yaml:"ec2"`
+}
+
+// InventoryConfig selects where the EC2 inventory comes from
+type InventoryConfig struct {
+	Source                 string                  `yaml:"source"`                   // "s3" (export in s3.bucket/s3.key, default) or "ec2"
+	RefreshIntervalMinutes int                     `yaml:"refresh_interval_minutes"` // How often to reload in the background, defaults to 5
+	Format                 string                  `yaml:"format"`                   // Format of the s3 export, defaults to the key extension
+	Mapping                MappingInventoryConfig  `yaml:"mapping"`
+	EC2                    EC2InventoryConfig      `yaml:"ec2"`
+	Sources                []InventorySourceConfig `yaml:"sources"`        // Replace the single source above; earlier sources win for instances listed twice
+	FilterColumns          []string                `yaml:"filter_columns"` // Extra columns or tags to filter on; empty offers all of them
+}
+
+// RoleConfig allows actions on the instances matching all of its non-empty filters
+type RoleConfig struct {
+	Actions            []string `yaml:"actions"` // "read", "restart", "command" or "schedule"
+	AccountNames       []string `yaml:"account_names"`
+	EnvironmentClasses []string `yaml:"environment_classes"`
+	Services           []string `yaml:"services"`
+	Owners             []string `yaml:"owners"`
+}
+
+// RBACConfig maps Azure AD groups to roles
+type RBACConfig struct {
+	Roles  map[string]RoleConfig `yaml:"roles"`  // Added to, or overriding, the built-in roles
+	Groups map[string][]string   `yaml:"groups"` // Group ID to role names; empty makes every user an admin
 }
 
 type EnvConfig struct {
-	S3       S3Config     `yaml:"s3"`
-	AzureAD  AzureADConfig `yaml:"azure_ad"`
-	Region   string        `yaml:"region"`
+	S3        S3Config        `yaml:"s3"`
+	AzureAD   AzureADConfig   `yaml:"azure_ad"`
+	Region    string          `yaml:"region"`
+	Restart   RestartConfig   `yaml:"restart"`
+	Command   CommandConfig   `yaml:"command"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Views     ViewsConfig     `yaml:"views"`
+	Report    ReportConfig    `yaml:"report"`
+	RBAC      RBACConfig      `yaml:"rbac"`
+	Inventory InventoryConfig `yaml:"inventory"`
 	// Adding Environment field to store the environment name
-	Environment string        // This is not from yaml, will be set programmatically
+	Environment string // This is not from yaml, will be set programmatically
 }
 
 type Config struct {
@@ -0,0 +1,596 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/models"
+	"ec2-restart-manager/utils"
+)
+
+// Valid "HH:MM" schedule times
+var scheduleTimePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// Valid schedule days, as shown on the config page
+var scheduleDays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// apiRoute is an API endpoint and the action a caller must be allowed to use it
+type apiRoute struct {
+	pattern string
+	action  string
+	handler http.HandlerFunc
+}
+
+// RegisterAPIRoutes registers the versioned JSON API under /api/v1 on the given mux.
+// Every route requires authentication and permission for the route's action.
+func RegisterAPIRoutes(mux *http.ServeMux) {
+	routes := []apiRoute{
+		{"GET /api/v1/instances", models.ActionRead, apiListInstances},
+		{"GET /api/v1/inventory/changes", models.ActionRead, apiListInventoryChanges},
+		{"GET /api/v1/jobs", models.ActionRead, apiListJobs},
+		{"POST /api/v1/jobs/restart", models.ActionRestart, apiCreateRestartJob},
+		{"POST /api/v1/jobs/command", models.ActionRead, apiCreateCommandJob},
+		{"GET /api/v1/jobs/{id}", models.ActionRead, apiGetJob},
+		{"GET /api/v1/jobs/{id}/instances/{instance_id}", models.ActionRead, apiGetTask},
+		{"GET /api/v1/jobs/{id}/instances/{instance_id}/output", models.ActionRead, apiGetTaskOutput},
+		{"POST /api/v1/jobs/{id}/cancel", models.ActionCommand, apiCancelCommand},
+		{"POST /api/v1/jobs/{id}/instances/{instance_id}/cancel", models.ActionCommand, apiCancelCommand},
+		{"GET /api/v1/commands", models.ActionRead, apiListCommands},
+		{"GET /api/v1/documents", models.ActionRead, apiListDocuments},
+		{"POST /api/v1/commands/{name}/run", models.ActionRead, apiRunLibraryCommand},
+		{"GET /api/v1/views", models.ActionRead, apiListViews},
+		{"POST /api/v1/views", models.ActionRead, apiCreateView},
+		{"DELETE /api/v1/views/{id}", models.ActionRead, apiDeleteView},
+		{"GET /api/v1/schedule", models.ActionRead, apiGetSchedule},
+		{"PUT /api/v1/schedule", models.ActionSchedule, apiUpdateSchedule},
+	}
+	for _, route := range routes {
+		mux.Handle(route.pattern, auth.APIAuthMiddleware(route.action, route.handler))
+	}
+
+	// Unknown API paths get a JSON error instead of the index page
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "no such API endpoint")
+	})
+
+	// The spec itself is public so that clients can be generated without credentials
+	mux.HandleFunc("GET /api/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		http.ServeFile(w, r, "api/openapi.yaml")
+	})
+}
+
+// apiListInstances lists the inventory, filtered by the query parameters of utils.ParseInstanceFilter
+// and, if given, a saved view. The instances are sorted, and paginated if a page is requested.
+func apiListInstances(w http.ResponseWriter, r *http.Request) {
+	filter, err := utils.ParseInstanceFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	instances := utils.FilterInstances(readableInstances(r, models.GetInstances()), filter)
+	if ref := r.URL.Query().Get("view"); ref != "" {
+		view, err := models.FindView(ref, auth.GetUserID(r))
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		selected, err := viewFilter(view)
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		instances = utils.FilterInstances(instances, selected)
+	}
+	utils.SortInstances(instances, utils.ParseInstanceOrder(r.URL.Query()))
+	total := len(instances)
+	if r.URL.Query().Has("page") || r.URL.Query().Has("per_page") {
+		instances = utils.ParseInstancePage(r.URL.Query(), total).Slice(instances)
+	}
+	if instances == nil {
+		instances = []models.EC2Instance{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"instances": instances, "total": total})
+}
+
+// apiListInventoryChanges lists the recent inventory diffs, newest first
+func apiListInventoryChanges(w http.ResponseWriter, r *http.Request) {
+	diffs := readableDiffs(r, models.ListInventoryDiffs())
+	if diffs == nil {
+		diffs = []models.InventoryDiff{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"diffs": diffs})
+}
+
+// apiListJobs lists the job history, optionally restricted to one job type, with the tasks the
+// caller may see
+func apiListJobs(w http.ResponseWriter, r *http.Request) {
+	var types []string
+	if jobType := r.URL.Query().Get("type"); jobType != "" {
+		types = append(types, jobType)
+	}
+
+	jobs, err := models.ListJobs(types...)
+	if err != nil {
+		log.Printf("Error listing jobs: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list jobs")
+		return
+	}
+	jobs = readableJobs(r, jobs)
+	if jobs == nil {
+		jobs = []*models.Job{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+}
+
+// restartJobRequest is the body of POST /api/v1/jobs/restart
+type restartJobRequest struct {
+	InstanceIDs []string `json:"instance_ids"`
+	Query       string   `json:"query"` // Filter expression selecting the instances instead of instance_ids
+	View        string   `json:"view"`  // ID or name of a saved view selecting the instances instead
+	WaitHealthy bool     `json:"wait_healthy"`
+}
+
+// apiCreateRestartJob reboots the requested instances and returns the created job
+func apiCreateRestartJob(w http.ResponseWriter, r *http.Request) {
+	var request restartJobRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	if !resolveSelectedInstances(w, r, request.Query, request.View, &request.InstanceIDs) ||
+		!requireKnownInstances(w, r, models.ActionRestart, request.InstanceIDs) {
+		return
+	}
+
+	job, err := startRestartJob(auth.GetUserName(r), request.InstanceIDs, request.WaitHealthy)
+	if err != nil {
+		log.Printf("Error creating restart job: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create job")
+		return
+	}
+	writeCreatedJob(w, job)
+}
+
+// commandJobRequest is the body of POST /api/v1/jobs/command
+type commandJobRequest struct {
+	InstanceIDs        []string            `json:"instance_ids"`
+	Query              string              `json:"query"`        // Filter expression selecting the instances instead of instance_ids
+	View               string              `json:"view"`         // ID or name of a saved view selecting the instances instead
+	CommandType        string              `json:"command_type"` // "patching", "upgrade", "custom" or "document"
+	CustomCommand      string              `json:"custom_command"`
+	Document           string              `json:"document"`            // SSM document of command_type document
+	DocumentParameters map[string][]string `json:"document_parameters"` // Parameters of the document, e.g. {"Operation": ["Install"]}
+	MaxConcurrency     string              `json:"max_concurrency"`     // Overrides command.max_concurrency, e.g. "10" or "25%"
+	MaxErrors          string              `json:"max_errors"`          // Overrides command.max_errors, e.g. "0" or "10%"
+}
+
+// apiCreateCommandJob runs a command on the requested instances and returns the created job.
+// Commands need the command action on every instance, documents their own action.
+func apiCreateCommandJob(w http.ResponseWriter, r *http.Request) {
+	var request commandJobRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+
+	action := models.ActionCommand
+
+	switch request.CommandType {
+	case "patching", "upgrade":
+	case "custom":
+		if request.CustomCommand == "" {
+			writeJSONError(w, http.StatusBadRequest, "custom_command is required for command_type custom")
+			return
+		}
+	case "document":
+		if request.Document == "" {
+			writeJSONError(w, http.StatusBadRequest, "document is required for command_type document")
+			return
+		}
+		document, exists := models.GetSSMDocument(request.Document)
+		if !exists {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown SSM document %q", request.Document))
+			return
+		}
+		action = document.Action
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown command_type %q", request.CommandType))
+		return
+	}
+	rollout := configuredCommandRollout()
+	if request.MaxConcurrency != "" {
+		rollout.MaxConcurrency = request.MaxConcurrency
+	}
+	if request.MaxErrors != "" {
+		rollout.MaxErrors = request.MaxErrors
+	}
+	if err := rollout.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !resolveSelectedInstances(w, r, request.Query, request.View, &request.InstanceIDs) ||
+		!requireKnownInstances(w, r, action, request.InstanceIDs) {
+		return
+	}
+
+	if request.CommandType == "document" {
+		job, status, err := startDocumentJob(auth.GetUserName(r), request.InstanceIDs, request.Document, request.DocumentParameters, rollout)
+		if err != nil {
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		writeCreatedJob(w, job)
+		return
+	}
+
+	command := commandRequest{Type: request.CommandType, Shell: request.CustomCommand}
+	job, err := startCommandJob(auth.GetUserName(r), request.InstanceIDs, command, rollout)
+	if err != nil {
+		log.Printf("Error creating command job: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create job")
+		return
+	}
+	writeCreatedJob(w, job)
+}
+
+// apiGetJob returns a job with the status of the tasks the caller may see. Jobs without any
+// such task are not found.
+func apiGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := models.GetJob(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if job = readableJob(r, job); len(job.Tasks) == 0 {
+		writeJSONError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// apiGetTask returns the status and output of one instance within a job
+func apiGetTask(w http.ResponseWriter, r *http.Request) {
+	task, err := findJobTask(r, r.PathValue("id"), r.PathValue("instance_id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, task)
+}
+
+// apiGetTaskOutput returns the full stdout, or stderr with stream=stderr, of a command on one
+// instance as plain text
+func apiGetTaskOutput(w http.ResponseWriter, r *http.Request) {
+	task, err := findJobTask(r, r.PathValue("id"), r.PathValue("instance_id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	stream := r.URL.Query().Get("stream")
+	if stream == "" {
+		stream = "stdout"
+	}
+	if stream != "stdout" && stream != "stderr" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown stream %q", stream))
+		return
+	}
+
+	content, truncated := commandTaskOutput(task, stream)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if truncated {
+		w.Header().Set("X-Output-Truncated", "true")
+	}
+	w.Write(content)
+}
+
+// apiCancelCommand cancels the command of a job on one instance, or on all instances where it
+// is still in flight, and returns the job
+func apiCancelCommand(w http.ResponseWriter, r *http.Request) {
+	job, err := models.GetJob(r.PathValue("id"))
+	if err != nil || !slices.Contains(commandJobTypes, job.Type) || len(readableJob(r, job).Tasks) == 0 {
+		writeJSONError(w, http.StatusNotFound, "command job not found")
+		return
+	}
+	instanceIDs := cancellableInstances(job, r.PathValue("instance_id"))
+	if len(instanceIDs) == 0 {
+		writeJSONError(w, http.StatusConflict, errNothingToCancel.Error())
+		return
+	}
+	if denied := deniedInstances(r, models.ActionCommand, instanceIDs); len(denied) > 0 {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("not allowed to command instances: %s", strings.Join(denied, ", ")))
+		return
+	}
+
+	if err := cancelCommandTasks(job, instanceIDs, auth.GetUserName(r)); err != nil {
+		log.Printf("Error cancelling command job %s: %v", job.ID, err)
+		writeJSONError(w, http.StatusBadGateway, "failed to cancel command on some instances")
+		return
+	}
+	if job, err = models.GetJob(job.ID); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load job")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, readableJob(r, job))
+}
+
+// apiListCommands lists the library commands the caller may run on at least some instances
+func apiListCommands(w http.ResponseWriter, r *http.Request) {
+	commands := usableLibraryCommands(r)
+	if commands == nil {
+		commands = []*models.CommandTemplate{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"commands": commands})
+}
+
+// apiListDocuments lists the SSM Command and Automation documents the caller may run on at
+// least some instances
+func apiListDocuments(w http.ResponseWriter, r *http.Request) {
+	documents := usableDocuments(r)
+	if documents == nil {
+		documents = []models.SSMDocument{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"documents": documents})
+}
+
+// libraryCommandRequest is the body of POST /api/v1/commands/{name}/run
+type libraryCommandRequest struct {
+	InstanceIDs    []string          `json:"instance_ids"`
+	Query          string            `json:"query"` // Filter expression selecting the instances instead of instance_ids
+	View           string            `json:"view"`  // ID or name of a saved view selecting the instances instead
+	Parameters     map[string]string `json:"parameters"`
+	MaxConcurrency string            `json:"max_concurrency"` // Overrides command.max_concurrency
+	MaxErrors      string            `json:"max_errors"`      // Overrides command.max_errors
+}
+
+// apiRunLibraryCommand runs a library command on the requested instances and returns the
+// created job. Members of the command's role may run it without the command action.
+func apiRunLibraryCommand(w http.ResponseWriter, r *http.Request) {
+	var request libraryCommandRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	rollout := configuredCommandRollout()
+	if request.MaxConcurrency != "" {
+		rollout.MaxConcurrency = request.MaxConcurrency
+	}
+	if request.MaxErrors != "" {
+		rollout.MaxErrors = request.MaxErrors
+	}
+	if err := rollout.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !resolveSelectedInstances(w, r, request.Query, request.View, &request.InstanceIDs) ||
+		!requireKnownInstances(w, r, models.ActionRead, request.InstanceIDs) {
+		return
+	}
+
+	command, status, err := libraryCommand(r, r.PathValue("name"), request.Parameters, request.InstanceIDs)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	job, err := startCommandJob(auth.GetUserName(r), request.InstanceIDs, command, rollout)
+	if err != nil {
+		log.Printf("Error creating command job: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create job")
+		return
+	}
+	writeCreatedJob(w, job)
+}
+
+// viewRequest is the body of POST /api/v1/views
+type viewRequest struct {
+	Name   string `json:"name"`
+	Scope  string `json:"scope"`  // "private" or "team"
+	Filter string `json:"filter"` // Encoded query parameters of GET /api/v1/instances
+}
+
+// apiListViews lists the saved views the caller sees
+func apiListViews(w http.ResponseWriter, r *http.Request) {
+	views, err := models.ListViews(auth.GetUserID(r))
+	if err != nil {
+		log.Printf("Error listing views: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list views")
+		return
+	}
+	if views == nil {
+		views = []*models.SavedView{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"views": views})
+}
+
+// apiCreateView saves a filter as a named view of the caller
+func apiCreateView(w http.ResponseWriter, r *http.Request) {
+	var request viewRequest
+	if !decodeJSONBody(w, r, &request) {
+		return
+	}
+	filter, err := normalizeViewFilter(request.Filter)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	view, err := models.CreateView(request.Name, request.Scope, filter, auth.GetUserID(r), auth.GetUserName(r))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("View %q (%s) saved by %s with scope %s", view.Name, view.ID, view.Owner, view.Scope)
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// apiDeleteView deletes a view of the caller
+func apiDeleteView(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := models.DeleteView(id, auth.GetUserID(r), false); err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	log.Printf("View %s deleted by %s", id, auth.GetUserName(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiGetSchedule returns the patching schedule from Parameter Store
+func apiGetSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := models.LoadScheduleConfig(); err != nil {
+		log.Printf("Error loading schedule configuration: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "failed to load schedule configuration")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.GetScheduleConfig())
+}
+
+// apiUpdateSchedule validates and saves a new patching schedule
+func apiUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.ScheduleConfig
+	if !decodeJSONBody(w, r, &schedule) {
+		return
+	}
+	if err := validateSchedule(schedule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := models.SaveScheduleConfig(schedule); err != nil {
+		log.Printf("Error saving schedule configuration: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "failed to save schedule configuration")
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// validateSchedule checks that all schedule days and times are set and well-formed
+func validateSchedule(schedule models.ScheduleConfig) error {
+	for field, day := range map[string]string{"stg_dev_day": schedule.StgDevDay, "prod_day": schedule.ProdDay} {
+		if !containsString(scheduleDays, day) {
+			return fmt.Errorf("%s must be a day of the week, got %q", field, day)
+		}
+	}
+	for field, value := range map[string]string{"stg_dev_time": schedule.StgDevTime, "prod_time": schedule.ProdTime} {
+		if !scheduleTimePattern.MatchString(value) {
+			return fmt.Errorf("%s must be a time in HH:MM format, got %q", field, value)
+		}
+	}
+	return nil
+}
+
+// resolveSelectedInstances sets instanceIDs to the readable instances matching a filter
+// expression or saved view, if one is given. It rejects requests selecting instances in
+// more than one way, invalid expressions, unknown views and selections matching no instances.
+func resolveSelectedInstances(w http.ResponseWriter, r *http.Request, query, view string, instanceIDs *[]string) bool {
+	selections := 0
+	for _, given := range []bool{len(*instanceIDs) > 0, query != "", view != ""} {
+		if given {
+			selections++
+		}
+	}
+	if selections > 1 {
+		writeJSONError(w, http.StatusBadRequest, "give only one of instance_ids, query or view")
+		return false
+	}
+
+	var filter utils.InstanceFilter
+	switch {
+	case query != "":
+		expression, err := utils.ParseInstanceQuery(query)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		filter.Expression = expression
+	case view != "":
+		savedView, err := models.FindView(view, auth.GetUserID(r))
+		if err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return false
+		}
+		if filter, err = viewFilter(savedView); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return false
+		}
+	default:
+		return true
+	}
+
+	for _, instance := range utils.FilterInstances(readableInstances(r, models.GetInstances()), filter) {
+		*instanceIDs = append(*instanceIDs, instance.ID)
+	}
+	if len(*instanceIDs) == 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "the selection matches no instances")
+		return false
+	}
+	return true
+}
+
+// requireKnownInstances rejects requests naming no instances, instances that are not in the
+// inventory or instances the caller may not perform action on
+func requireKnownInstances(w http.ResponseWriter, r *http.Request, action string, instanceIDs []string) bool {
+	if len(instanceIDs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "instance_ids is required")
+		return false
+	}
+	for _, instanceID := range instanceIDs {
+		if _, err := models.GetInstanceDetails(instanceID); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, fmt.Sprintf("unknown instance %s", instanceID))
+			return false
+		}
+	}
+	if denied := deniedInstances(r, action, instanceIDs); len(denied) > 0 {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("not allowed to %s instances: %s", action, strings.Join(denied, ", ")))
+		return false
+	}
+	return true
+}
+
+// decodeJSONBody decodes the request body into v, answering with a 400 error if it is invalid
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// writeCreatedJob answers with 202 Accepted, since the job keeps running in the background
+func writeCreatedJob(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+// writeJSONError writes an error message as a JSON response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// containsString checks if a slice contains a string
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+	"ec2-restart-manager/utils"
+)
+
+// APIKeysHandler lists API keys and creates new ones. The secret of a new key is shown
+// only once, on the page answering its creation.
+func APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	instances := models.GetInstances()
+	pageData := map[string]interface{}{
+		"Scopes":             models.AllActions,
+		"AccountNames":       utils.GetUniqueAWSAccountNames(instances),
+		"EnvironmentClasses": utils.GetUniqueEnvironmentClasses(instances),
+		"Services":           utils.GetUniqueServices(instances),
+		"Owners":             utils.GetUniqueOwners(instances),
+		"Revoked":            r.URL.Query().Get("revoked") == "true",
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+			return
+		}
+
+		// A key may only do what its creator may do, on instances the creator may do it on
+		scope := models.Grant{
+			Actions:            r.Form["scopes"],
+			AccountNames:       r.Form["account_names"],
+			EnvironmentClasses: r.Form["environment_classes"],
+			Services:           r.Form["services"],
+			Owners:             r.Form["owners"],
+		}
+		var key *models.APIKey
+		var secret string
+		err := auth.GetPrincipal(r).CanDelegate(scope)
+		if err == nil {
+			key, secret, err = models.CreateAPIKey(r.FormValue("name"), auth.GetUserName(r), scope)
+		}
+		if err != nil {
+			log.Printf("Error creating API key: %v", err)
+			pageData["Error"] = err.Error()
+		} else {
+			log.Printf("API key %s (%s) created by %s with scopes %v on %+v", key.Name, key.ID, key.CreatedBy, key.Scopes, scope)
+			pageData["NewKey"] = key
+			pageData["NewSecret"] = secret
+		}
+	}
+
+	keys, err := models.ListAPIKeys()
+	if err != nil {
+		http.Error(w, "Failed to load API keys", http.StatusInternalServerError)
+		log.Printf("Error loading API keys: %v", err)
+		return
+	}
+	pageData["Keys"] = keys
+
+	data := models.TemplateData{
+		Title:      "API Keys",
+		IsLoggedIn: auth.IsUserLoggedIn(r),
+		UserName:   auth.GetUserName(r),
+		Version:    config.Version,
+		Data:       pageData,
+	}
+
+	tmpl, err := template.ParseFiles("templates/api_keys.html", "templates/layout.html")
+	if err != nil {
+		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		log.Printf("Error loading templates: %v\n", err)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error rendering API keys page: %v\n", err)
+		http.Error(w, "Error rendering API keys page", http.StatusInternalServerError)
+	}
+}
+
+// RevokeAPIKeyHandler revokes an API key
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.FormValue("id")
+	if err := models.RevokeAPIKey(id, auth.GetUserName(r)); err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		log.Printf("Error revoking API key %s: %v", id, err)
+		return
+	}
+	log.Printf("API key %s revoked by %s", id, auth.GetUserName(r))
+
+	http.Redirect(w, r, "/api-keys?revoked=true", http.StatusSeeOther)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+)
+
+// AuditHandler renders the searchable audit trail
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Redirect(w, r, "/access_denied", http.StatusFound)
+		return
+	}
+
+	entries, err := searchAudit(r)
+	if err != nil {
+		http.Error(w, "Failed to load audit trail", http.StatusInternalServerError)
+		log.Printf("Error loading audit trail: %v", err)
+		return
+	}
+
+	data := models.TemplateData{
+		Title:      "Audit Trail",
+		IsLoggedIn: auth.IsUserLoggedIn(r),
+		UserName:   auth.GetUserName(r),
+		Version:    config.Version,
+		Data: map[string]interface{}{
+			"Entries":       entries,
+			"Actions":       []string{models.JobTypeRestart, models.JobTypeStopStart, models.JobTypeRollout, models.JobTypeCommand, models.JobTypeAutomation},
+			"Query":         r.URL.Query(),
+			"CSVExportURL":  auditExportURL(r, "csv"),
+			"JSONExportURL": auditExportURL(r, "json"),
+		},
+	}
+
+	tmpl, err := template.ParseFiles("templates/audit.html", "templates/layout.html")
+	if err != nil {
+		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		log.Printf("Error loading templates: %v\n", err)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error rendering audit page: %v\n", err)
+		http.Error(w, "Error rendering audit page", http.StatusInternalServerError)
+	}
+}
+
+// AuditExportHandler exports the matching audit entries as CSV or JSON
+func AuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Error(w, "Not allowed to read the audit trail", http.StatusForbidden)
+		return
+	}
+
+	entries, err := searchAudit(r)
+	if err != nil {
+		http.Error(w, "Failed to load audit trail", http.StatusInternalServerError)
+		log.Printf("Error loading audit trail: %v", err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.json"`)
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			log.Printf("Error writing audit JSON export: %v", err)
+		}
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"Timestamp", "User", "Action", "Description", "Job ID", "Instance ID",
+			"Account ID", "Account Name", "Region", "Command", "Command ID", "Outcome", "Cancelled By"})
+		for _, e := range entries {
+			writer.Write([]string{e.Timestamp.Format(time.RFC3339), e.User, e.Action, e.Description, e.JobID,
+				e.InstanceID, e.AccountID, e.AccountName, e.Region, e.Command, e.CommandID, e.Outcome, e.CancelledBy})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			log.Printf("Error writing audit CSV export: %v", err)
+		}
+	default:
+		http.Error(w, "Unsupported export format", http.StatusBadRequest)
+	}
+}
+
+// auditExportURL builds the export link for the current search in the given format
+func auditExportURL(r *http.Request, format string) string {
+	query := r.URL.Query()
+	query.Set("format", format)
+	return "/audit/export?" + query.Encode()
+}
+
+// searchAudit returns the audit entries of instances the caller may see matching the q, user,
+// action and instance query parameters
+func searchAudit(r *http.Request) ([]models.AuditEntry, error) {
+	entries, err := models.ListAuditEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.URL.Query()
+	var matching []models.AuditEntry
+	for _, entry := range entries {
+		if (query.Get("user") == "" || entry.User == query.Get("user")) &&
+			(query.Get("action") == "" || entry.Action == query.Get("action")) &&
+			(query.Get("instance") == "" || entry.InstanceID == query.Get("instance")) &&
+			entry.Matches(query.Get("q")) && canReadInstance(r, entry.InstanceID, entry.AccountName) {
+			matching = append(matching, entry)
+		}
+	}
+	return matching, nil
+}
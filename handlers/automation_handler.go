@@ -0,0 +1,284 @@
+// handlers/automation_handler.go
+package handlers
+
+import (
+    "fmt"
+    "log"
+    "net/http"
+    "reflect"
+    "sort"
+    "strings"
+    "time"
+
+    "ec2-restart-manager/auth"
+    "ec2-restart-manager/aws"
+    "ec2-restart-manager/models"
+    awssdk "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// usableDocuments returns the SSM documents the caller may run on at least some instances
+func usableDocuments(r *http.Request) []models.SSMDocument {
+    var documents []models.SSMDocument
+    for _, document := range models.ListSSMDocuments() {
+        if auth.Can(r, document.Action) {
+            documents = append(documents, document)
+        }
+    }
+    return documents
+}
+
+// startDocumentJob runs an SSM document on the instances: Command documents are sent like
+// shell commands, Automation documents are started once per instance. The caller must have
+// checked the document's action on the instances. The returned status code goes with the error.
+func startDocumentJob(user string, instanceIDs []string, name string, parameters map[string][]string, rollout commandRollout) (*models.Job, int, error) {
+    document, exists := models.GetSSMDocument(name)
+    if !exists {
+        return nil, http.StatusBadRequest, fmt.Errorf("unknown SSM document %q", name)
+    }
+    if parameters == nil {
+        parameters = make(map[string][]string)
+    }
+    if err := document.CheckParameters(parameters); err != nil {
+        return nil, http.StatusBadRequest, err
+    }
+
+    var job *models.Job
+    var err error
+    if document.Type == models.DocumentTypeAutomation {
+        job, err = startAutomationJob(user, instanceIDs, document, parameters)
+    } else {
+        if err := rollout.validate(); err != nil {
+            return nil, http.StatusBadRequest, err
+        }
+        job, err = startCommandJob(user, instanceIDs, commandRequest{Type: "document", Document: name, Parameters: parameters}, rollout)
+    }
+    if err != nil {
+        log.Printf("Error creating job for SSM document %s: %v", name, err)
+        return nil, http.StatusInternalServerError, fmt.Errorf("failed to create job")
+    }
+    return job, http.StatusOK, nil
+}
+
+// startAutomationJob creates an automation job and starts one execution of the document per
+// instance, with the document's target parameter set to the instance ID. The role is assumed
+// once per account, and the executions of each account and region are polled together.
+func startAutomationJob(user string, instanceIDs []string, document models.SSMDocument, parameters map[string][]string) (*models.Job, error) {
+    job, err := models.NewJob(models.JobTypeAutomation, user, "Automation: "+document.Name, instanceIDs)
+    if err != nil {
+        return nil, err
+    }
+    command := strings.TrimSpace(document.Name + " " + models.FormatDocumentParameters(parameters))
+
+    var batches []*commandBatch
+    batchIndex := make(map[string]*commandBatch)
+    for _, instanceID := range instanceIDs {
+        instance, err := models.GetInstanceDetails(instanceID)
+        if err != nil {
+            log.Printf("Error fetching instance details for %s: %v", instanceID, err)
+            updateCommandStatus(job.ID, instanceID, "Failed to fetch instance details", "", "", "", true)
+            continue
+        }
+        key := instance.AWSAccountNumber + "\x00" + instance.Region
+        batch := batchIndex[key]
+        if batch == nil {
+            batch = &commandBatch{AccountNumber: instance.AWSAccountNumber, Region: instance.Region, Command: command}
+            batchIndex[key] = batch
+            batches = append(batches, batch)
+        }
+        batch.InstanceIDs = append(batch.InstanceIDs, instanceID)
+    }
+
+    assumedConfigs := make(map[string]awssdk.Config)
+    for _, batch := range batches {
+        assumedConfig, assumed := assumedConfigs[batch.AccountNumber]
+        if !assumed {
+            assumedConfig, err = aws.AssumeRoleInAccount(command_role_name, batch.AccountNumber)
+            if err != nil {
+                log.Printf("Error assuming role in account %s for %d instances: %v", batch.AccountNumber, len(batch.InstanceIDs), err)
+                for _, instanceID := range batch.InstanceIDs {
+                    updateCommandStatus(job.ID, instanceID, "Failed to assume role in account", "", "", command, true)
+                }
+                continue
+            }
+            assumedConfigs[batch.AccountNumber] = assumedConfig
+        }
+
+        ssmClient, err := aws.NewSSMClient(assumedConfig, batch.Region)
+        if err != nil {
+            log.Printf("Error creating SSM client in region %s for account %s: %v", batch.Region, batch.AccountNumber, err)
+            for _, instanceID := range batch.InstanceIDs {
+                updateCommandStatus(job.ID, instanceID, "Failed to create SSM client", "", "", command, true)
+            }
+            continue
+        }
+
+        executions := make(map[string]string)
+        for _, instanceID := range batch.InstanceIDs {
+            instanceParameters := map[string][]string{document.TargetParameter: {instanceID}}
+            for name, values := range parameters {
+                instanceParameters[name] = values
+            }
+            executionID, err := aws.StartAutomation(ssmClient, document.Name, instanceParameters)
+            if err != nil {
+                log.Printf("Failed to start automation %s on instance %s: %v", document.Name, instanceID, err)
+                updateCommandStatus(job.ID, instanceID, "Failed to start automation", "", "", command, true)
+                continue
+            }
+            recordAutomationStarted(job.ID, instanceID, executionID, command)
+            executions[instanceID] = executionID
+        }
+
+        // One goroutine follows the executions of the account and region
+        if len(executions) > 0 {
+            go checkAutomationExecutions(ssmClient, job.ID, executions, command)
+        }
+    }
+
+    return job, nil
+}
+
+// automationFinished reports whether an Automation execution status is final
+func automationFinished(status string) bool {
+    switch status {
+    case "Pending", "InProgress", "Waiting", "Cancelling", "Scheduled", "RunbookInProgress",
+        "PendingApproval", "Approved", "PendingChangeCalendarOverride", "ChangeCalendarOverrideApproved":
+        return false
+    }
+    return true
+}
+
+// checkAutomationExecutions periodically checks the status and steps of the Automation
+// execution of each instance. It gives up on the remaining executions after 10 minutes
+// without any change.
+func checkAutomationExecutions(ssmClient *ssm.Client, jobID string, executions map[string]string, command string) {
+    // Wait a few seconds before starting to check status
+    time.Sleep(5 * time.Second)
+
+    pending := make(map[string]string)
+    for instanceID, executionID := range executions {
+        pending[instanceID] = executionID
+    }
+    last := make(map[string]aws.AutomationExecution)
+    failing := make(map[string]bool) // Instances whose last check failed
+
+    // Check status every 10 seconds, for up to 60 checks in a row without progress. A failed
+    // check, e.g. when throttled, is no progress and is retried on the next round.
+    for idle := 0; idle < 60; {
+        progressed := false
+        for instanceID, executionID := range pending {
+            execution, err := aws.GetAutomation(ssmClient, executionID)
+            if err != nil {
+                log.Printf("Error checking status of automation execution %s, retrying: %v", executionID, err)
+                failing[instanceID] = true
+                continue
+            }
+            delete(failing, instanceID)
+            if reflect.DeepEqual(last[instanceID], execution) {
+                continue
+            }
+            last[instanceID] = execution
+            progressed = true
+
+            done := automationFinished(execution.Status)
+            recordAutomationExecution(jobID, instanceID, command, execution, done)
+            if done {
+                delete(pending, instanceID)
+            }
+        }
+
+        // Once every execution has a final status, we're done
+        if len(pending) == 0 {
+            return
+        }
+        if progressed {
+            idle = 0
+        } else {
+            idle++
+        }
+
+        // Wait before checking again
+        time.Sleep(10 * time.Second)
+    }
+
+    // If we get here, the executions have made no progress for too long, or their status
+    // could not be checked since
+    for instanceID := range pending {
+        status := "Timeout"
+        if failing[instanceID] {
+            status = "Error checking status"
+        }
+        updateCommandStatus(jobID, instanceID, status, automationOutputs(last[instanceID].Outputs), "", command, true)
+    }
+}
+
+// recordAutomationStarted records the Automation execution started for an instance
+func recordAutomationStarted(jobID, instanceID, executionID, command string) {
+    err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+        task.Status = "Pending"
+        task.AutomationID = executionID
+        task.Command = command
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
+    }
+}
+
+// recordAutomationExecution records the status, outputs and step progress of the Automation
+// execution of an instance. The failure message is kept as the task's standard error.
+func recordAutomationExecution(jobID, instanceID, command string, execution aws.AutomationExecution, done bool) {
+    var steps []models.TaskStep
+    for _, step := range execution.Steps {
+        taskStep := models.TaskStep{
+            Name:    step.Name,
+            Action:  step.Action,
+            Status:  step.Status,
+            Message: step.FailureMessage,
+        }
+        if !step.StartedAt.IsZero() {
+            startedAt := step.StartedAt
+            taskStep.StartedAt = &startedAt
+        }
+        if !step.EndedAt.IsZero() {
+            endedAt := step.EndedAt
+            taskStep.EndedAt = &endedAt
+        }
+        steps = append(steps, taskStep)
+    }
+
+    err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+        task.Status = execution.Status
+        task.Done = done
+        task.Command = command
+        task.AutomationID = execution.ID
+        task.Output = automationOutputs(execution.Outputs)
+        task.Stderr = execution.FailureMessage
+        task.Steps = steps
+        if !execution.StartedAt.IsZero() {
+            startedAt := execution.StartedAt
+            task.ExecutionStartedAt = &startedAt
+        }
+        if !execution.EndedAt.IsZero() {
+            endedAt := execution.EndedAt
+            task.ExecutionEndedAt = &endedAt
+        }
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
+    }
+}
+
+// automationOutputs writes the outputs of an Automation execution one per line, sorted by name
+func automationOutputs(outputs map[string][]string) string {
+    names := make([]string, 0, len(outputs))
+    for name := range outputs {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var lines []string
+    for _, name := range names {
+        lines = append(lines, name+": "+strings.Join(outputs[name], ", "))
+    }
+    return strings.Join(lines, "\n")
+}
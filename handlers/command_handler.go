@@ -2,12 +2,15 @@
 package handlers
 
 import (
+    "errors"
     "fmt"
     "log"
     "net/http"
     "strconv"
+    "reflect"
+    "regexp"
+    "slices"
     "strings"
-    "sync"
     "time"
     "html/template"
 
@@ -15,6 +18,7 @@ import (
     "ec2-restart-manager/models"
     "ec2-restart-manager/auth"
     "ec2-restart-manager/config"
+    awssdk "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
@@ -134,45 +138,207 @@ func getUTCTimeFromRegional(day string, timeStr string, regionTimezone string) (
 
 var command_role_name = "ec2-restart-manager-restarter"
 
-// Mutex to handle concurrent access to the command status map
-var commandStatusLock sync.Mutex
-
-// Struct to store the status and output of each command execution
-type CommandStatus struct {
-    Status    string // e.g., "Success", "Failed", "InProgress"
-    Output    string // Command output
-    Timestamp string // ISO 8601 format timestamp
-    CommandID string // AWS SSM Command ID
-    Command   string // The command that was executed
+// commandRequest is a command to run on the selected instances
+type commandRequest struct {
+    Type       string              // "patching", "upgrade", "custom", "library" or "document"
+    Shell      string              // Shell command of a custom command, or the rendered library command
+    Name       string              // Name of a library command
+    Document   string              // Command document to run instead of a shell command
+    Parameters map[string][]string // Parameters of the document
 }
 
-// Map to store the status of each command execution operation
-var commandStatusMap = make(map[string]CommandStatus)
+// description returns the job description for a command
+func (c commandRequest) description() string {
+    switch c.Type {
+    case "patching":
+        return "Security Patching"
+    case "upgrade":
+        return "System Upgrade"
+    case "custom":
+        return "Custom Command"
+    case "library":
+        return "Library: " + c.Name
+    case "document":
+        return "Document: " + c.Document
+    default:
+        return c.Type
+    }
+}
 
 // CommandHandler handles the request to execute commands on EC2 instances
 func CommandHandler(w http.ResponseWriter, r *http.Request) {
-    // First refresh the schedule configuration
-    if err := models.LoadScheduleConfig(); err != nil {
-        log.Printf("Error refreshing schedule configuration: %v", err)
-        // Continue anyway with the cached config
-    } else {
-        log.Printf("Successfully refreshed schedule configuration before command execution")
-    }
-
     if err := r.ParseForm(); err != nil {
         http.Error(w, "Failed to parse form data", http.StatusBadRequest)
         log.Printf("Error parsing form data: %v", err)
         return
     }
 
-    instanceIDs := r.Form["instance_ids"]
-    commandType := r.FormValue("command_type")
-    customCommand := r.FormValue("custom_command")
+    instanceIDs, err := selectedInstanceIDs(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    request := commandRequest{Type: r.FormValue("command_type"), Shell: r.FormValue("custom_command")}
     
     if len(instanceIDs) == 0 {
         http.Error(w, "No instance IDs provided", http.StatusBadRequest)
         return
     }
+    if request.Type == "document" {
+        // Automation documents run as their own kind of job
+        parameters, err := models.ParseDocumentParameters(r.FormValue("document_parameters"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        document, exists := models.GetSSMDocument(r.FormValue("document"))
+        if !exists {
+            http.Error(w, "Unknown SSM document", http.StatusBadRequest)
+            return
+        }
+        if !requireInstancePermission(w, r, document.Action, instanceIDs) {
+            return
+        }
+        job, status, err := startDocumentJob(auth.GetUserName(r), instanceIDs, document.Name, parameters, configuredCommandRollout())
+        if err != nil {
+            http.Error(w, err.Error(), status)
+            return
+        }
+        http.Redirect(w, r, "/command-status?job="+job.ID, http.StatusSeeOther)
+        return
+    } else if request.Type == "library" {
+        // Library commands check their own permissions and environments
+        values := make(map[string]string)
+        for key := range r.PostForm {
+            if name, isParameter := strings.CutPrefix(key, "param_"); isParameter {
+                values[name] = r.PostForm.Get(key)
+            }
+        }
+        var status int
+        if request, status, err = libraryCommand(r, r.FormValue("library_command"), values, instanceIDs); err != nil {
+            http.Error(w, err.Error(), status)
+            return
+        }
+    } else if !requireInstancePermission(w, r, models.ActionCommand, instanceIDs) {
+        return
+    }
+    rollout := configuredCommandRollout()
+    if err := rollout.validate(); err != nil {
+        http.Error(w, "Invalid command rollout configuration", http.StatusInternalServerError)
+        log.Printf("Error in command configuration: %v", err)
+        return
+    }
+
+    job, err := startCommandJob(auth.GetUserName(r), instanceIDs, request, rollout)
+    if err != nil {
+        http.Error(w, "Failed to create job", http.StatusInternalServerError)
+        log.Printf("Error creating command job: %v", err)
+        return
+    }
+
+    // Redirect to the command status page
+    http.Redirect(w, r, "/command-status?job="+job.ID, http.StatusSeeOther)
+}
+
+// libraryCommand renders a library command with the given parameter values, checking that the
+// caller may run it on every instance. The returned status code goes with the error.
+func libraryCommand(r *http.Request, name string, values map[string]string, instanceIDs []string) (commandRequest, int, error) {
+    command, exists := models.GetCommandTemplate(name)
+    if !exists {
+        return commandRequest{}, http.StatusNotFound, fmt.Errorf("unknown library command %q", name)
+    }
+
+    var denied []string
+    for _, instanceID := range instanceIDs {
+        instance, err := models.GetInstanceDetails(instanceID)
+        if err != nil || !auth.CanRunCommand(r, command, *instance) {
+            denied = append(denied, instanceID)
+        }
+    }
+    if len(denied) > 0 {
+        log.Printf("%s denied library command %s on %v", auth.GetUserName(r), name, denied)
+        return commandRequest{}, http.StatusForbidden, fmt.Errorf("not allowed to run %s on instances: %s", name, strings.Join(denied, ", "))
+    }
+
+    shell, err := command.Render(values)
+    if err != nil {
+        return commandRequest{}, http.StatusBadRequest, err
+    }
+    return commandRequest{Type: "library", Shell: shell, Name: name}, http.StatusOK, nil
+}
+
+// usableLibraryCommands lists the library commands the caller may run on at least some instances
+func usableLibraryCommands(r *http.Request) []*models.CommandTemplate {
+    var commands []*models.CommandTemplate
+    for _, command := range models.ListCommandTemplates() {
+        if auth.CanUseCommand(r, command) {
+            commands = append(commands, command)
+        }
+    }
+    return commands
+}
+
+// commandBatch is the instances of one account and region receiving the same command
+type commandBatch struct {
+    AccountNumber string
+    Region        string
+    Command       string
+    CommandName   string
+    DocumentName  string              // Command document, AWS-RunShellScript if empty
+    Parameters    map[string][]string // Parameters of the document
+    CommandID     string // Set once the command was sent
+    InstanceIDs   []string
+}
+
+// commandRollout controls how fast a command reaches the instances of a batch
+type commandRollout struct {
+    MaxConcurrency string
+    MaxErrors      string
+}
+
+// Rollout pattern accepted by SSM for MaxConcurrency and MaxErrors: a number or a percentage
+var commandRolloutPattern = regexp.MustCompile(`^(0|[1-9][0-9]*|([1-9]?[0-9]|100)%)$`)
+
+// configuredCommandRollout returns the rollout of command.max_concurrency and command.max_errors,
+// sending to all instances of a batch at once and ignoring errors by default
+func configuredCommandRollout() commandRollout {
+    rollout := commandRollout{MaxConcurrency: "50", MaxErrors: "100%"}
+    if cfg != nil && cfg.Command.MaxConcurrency != "" {
+        rollout.MaxConcurrency = cfg.Command.MaxConcurrency
+    }
+    if cfg != nil && cfg.Command.MaxErrors != "" {
+        rollout.MaxErrors = cfg.Command.MaxErrors
+    }
+    return rollout
+}
+
+// validate checks that SSM accepts the rollout settings
+func (r commandRollout) validate() error {
+    if !commandRolloutPattern.MatchString(r.MaxConcurrency) || r.MaxConcurrency == "0" || r.MaxConcurrency == "0%" {
+        return fmt.Errorf("max_concurrency must be a positive number or percentage, got %q", r.MaxConcurrency)
+    }
+    if !commandRolloutPattern.MatchString(r.MaxErrors) {
+        return fmt.Errorf("max_errors must be a number or percentage, got %q", r.MaxErrors)
+    }
+    return nil
+}
+
+// startCommandJob creates a command job and sends the command with one SendCommand call per
+// account, region and command, rather than per instance. The invocations of each call are then
+// polled in the background.
+func startCommandJob(user string, instanceIDs []string, request commandRequest, rollout commandRollout) (*models.Job, error) {
+    // First refresh the schedule configuration
+    if err := models.LoadScheduleConfig(); err != nil {
+        log.Printf("Error refreshing schedule configuration: %v", err)
+        // Continue anyway with the cached config
+    } else {
+        log.Printf("Successfully refreshed schedule configuration before command execution")
+    }
+
+    job, err := models.NewJob(models.JobTypeCommand, user, request.description(), instanceIDs)
+    if err != nil {
+        return nil, err
+    }
 
     // Get the schedule configuration (now guaranteed to be fresh)
     scheduleConfig := models.GetScheduleConfig()
@@ -180,19 +346,21 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                scheduleConfig.StgDevDay, scheduleConfig.StgDevTime, 
                scheduleConfig.ProdDay, scheduleConfig.ProdTime)
 
+    var batches []*commandBatch
+    batchIndex := make(map[string]*commandBatch)
     for _, instanceID := range instanceIDs {
         // Retrieve instance details such as account number and region
         instance, err := models.GetInstanceDetails(instanceID)
         if err != nil {
             log.Printf("Error fetching instance details for %s: %v", instanceID, err)
-            updateCommandStatus(instanceID, "Failed to fetch instance details", "", "", "")
+            updateCommandStatus(job.ID, instanceID, "Failed to fetch instance details", "", "", "", true)
             continue
         }
 
         // Determine which command to execute based on command type and environment class
         var command, commandName string
         
-        if commandType == "patching" {
+        if request.Type == "patching" {
             baseCommand := "sudo yum update-minimal --security -y || sudo dnf update --security --bugfix --enhancement=important --enhancement=moderate --enhancement=low -y"
             envClass := instance.EnvironmentClass
             
@@ -212,7 +380,7 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 )
                 if err != nil {
                     log.Printf("Error converting timezone for instance %s in region %s: %v", instanceID, instance.Region, err)
-                    updateCommandStatus(instanceID, "Failed to convert timezone", "", "", "")
+                    updateCommandStatus(job.ID, instanceID, "Failed to convert timezone", "", "", "", true)
                     continue
                 }
                 
@@ -243,7 +411,7 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 )
                 if err != nil {
                     log.Printf("Error converting timezone for instance %s in region %s: %v", instanceID, instance.Region, err)
-                    updateCommandStatus(instanceID, "Failed to convert timezone", "", "", "")
+                    updateCommandStatus(job.ID, instanceID, "Failed to convert timezone", "", "", "", true)
                     continue
                 }
                 
@@ -263,7 +431,7 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 command = baseCommand
                 commandName = "Security Patching"
             }
-        } else if commandType == "upgrade" {
+        } else if request.Type == "upgrade" {
             baseCommand := "sudo yum update -y || sudo dnf update -y"
             envClass := instance.EnvironmentClass
             
@@ -283,7 +451,7 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 )
                 if err != nil {
                     log.Printf("Error converting timezone for instance %s in region %s: %v", instanceID, instance.Region, err)
-                    updateCommandStatus(instanceID, "Failed to convert timezone", "", "", "")
+                    updateCommandStatus(job.ID, instanceID, "Failed to convert timezone", "", "", "", true)
                     continue
                 }
                 
@@ -314,7 +482,7 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 )
                 if err != nil {
                     log.Printf("Error converting timezone for instance %s in region %s: %v", instanceID, instance.Region, err)
-                    updateCommandStatus(instanceID, "Failed to convert timezone", "", "", "")
+                    updateCommandStatus(job.ID, instanceID, "Failed to convert timezone", "", "", "", true)
                     continue
                 }
                 
@@ -334,137 +502,286 @@ func CommandHandler(w http.ResponseWriter, r *http.Request) {
                 command = baseCommand
                 commandName = "System Upgrade"
             }
-        } else if commandType == "custom" && customCommand != "" {
-            command = customCommand
-            commandName = "Custom Command"
+        } else if (request.Type == "custom" || request.Type == "library") && request.Shell != "" {
+            command = request.Shell
+            commandName = request.description()
+        } else if request.Type == "document" && request.Document != "" {
+            // The parameters are shown as the command, and are the same for every instance
+            command = strings.TrimSpace(request.Document + " " + models.FormatDocumentParameters(request.Parameters))
+            commandName = request.description()
         } else {
-            updateCommandStatus(instanceID, "Invalid command type", "", "", "")
+            updateCommandStatus(job.ID, instanceID, "Invalid command type", "", "", "", true)
             continue
         }
 
-        // Assume the role in the target AWS account and get the AWS Config
-        assumedConfig, err := aws.AssumeRoleInAccount(command_role_name, instance.AWSAccountNumber)
-        if err != nil {
-            log.Printf("Error assuming role in account %s for instance %s: %v", instance.AWSAccountNumber, instanceID, err)
-            updateCommandStatus(instanceID, "Failed to assume role in account", "", "", command)
-            continue
+        // Group the instance with the others of its account and region getting the same command
+        key := strings.Join([]string{instance.AWSAccountNumber, instance.Region, command, commandName}, "\x00")
+        batch := batchIndex[key]
+        if batch == nil {
+            batch = &commandBatch{
+                AccountNumber: instance.AWSAccountNumber,
+                Region:        instance.Region,
+                Command:       command,
+                CommandName:   commandName,
+            }
+            if request.Type == "document" {
+                batch.DocumentName = request.Document
+                batch.Parameters = request.Parameters
+            }
+            batchIndex[key] = batch
+            batches = append(batches, batch)
+        }
+        batch.InstanceIDs = append(batch.InstanceIDs, instanceID)
+    }
+
+    // Assume the role once per account, whatever the number of regions and commands
+    assumedConfigs := make(map[string]awssdk.Config)
+    for _, batch := range batches {
+        assumedConfig, assumed := assumedConfigs[batch.AccountNumber]
+        if !assumed {
+            var err error
+            assumedConfig, err = aws.AssumeRoleInAccount(command_role_name, batch.AccountNumber)
+            if err != nil {
+                log.Printf("Error assuming role in account %s for %d instances: %v", batch.AccountNumber, len(batch.InstanceIDs), err)
+                for _, instanceID := range batch.InstanceIDs {
+                    updateCommandStatus(job.ID, instanceID, "Failed to assume role in account", "", "", batch.Command, true)
+                }
+                continue
+            }
+            assumedConfigs[batch.AccountNumber] = assumedConfig
         }
 
         // Create an SSM client using the assumed role config and target region
-        ssmClient, err := aws.NewSSMClient(assumedConfig, instance.Region)
+        ssmClient, err := aws.NewSSMClient(assumedConfig, batch.Region)
         if err != nil {
-            log.Printf("Error creating SSM client in region %s for instance %s: %v", instance.Region, instanceID, err)
-            updateCommandStatus(instanceID, "Failed to create SSM client", "", "", command)
+            log.Printf("Error creating SSM client in region %s for account %s: %v", batch.Region, batch.AccountNumber, err)
+            for _, instanceID := range batch.InstanceIDs {
+                updateCommandStatus(job.ID, instanceID, "Failed to create SSM client", "", "", batch.Command, true)
+            }
             continue
         }
 
-        // Execute the command on the instance
-        commandID, err := aws.ExecuteSSMCommand(ssmClient, instanceID, command, commandName)
-        if err != nil {
-            log.Printf("Failed to execute command on instance %s: %v", instanceID, err)
-            updateCommandStatus(instanceID, "Failed to execute command", "", "", command)
-        } else {
-            log.Printf("Command execution initiated on instance %s", instanceID)
-            updateCommandStatus(instanceID, "InProgress", "", commandID, command)
-            
-            // Start a goroutine to check the command status periodically
-            go checkCommandStatus(ssmClient, commandID, instanceID, instance.Region, command)
+        // SSM takes a limited number of instance IDs per call
+        for first := 0; first < len(batch.InstanceIDs); first += aws.MaxCommandInstances {
+            targets := batch.InstanceIDs[first:min(first+aws.MaxCommandInstances, len(batch.InstanceIDs))]
+            outputBucket, outputPrefix := commandOutputLocation()
+            commandID, err := aws.SendSSMCommand(ssmClient, aws.SSMCommand{
+                InstanceIDs:    targets,
+                Command:        batch.Command,
+                DocumentName:   batch.DocumentName,
+                Parameters:     batch.Parameters,
+                Comment:        batch.CommandName,
+                MaxConcurrency: rollout.MaxConcurrency,
+                MaxErrors:      rollout.MaxErrors,
+                OutputS3Bucket: outputBucket,
+                OutputS3Prefix: outputPrefix,
+            })
+            if err != nil {
+                log.Printf("Failed to send command to %d instances in account %s, region %s: %v", len(targets), batch.AccountNumber, batch.Region, err)
+                for _, instanceID := range targets {
+                    updateCommandStatus(job.ID, instanceID, "Failed to execute command", "", "", batch.Command, true)
+                }
+                continue
+            }
+
+            log.Printf("Command %s sent to %d instances in account %s, region %s", commandID, len(targets), batch.AccountNumber, batch.Region)
+            for _, instanceID := range targets {
+                recordCommandSent(job.ID, instanceID, commandID, batch.Command, outputBucket, outputPrefix)
+            }
+
+            // One goroutine follows all instances of the command
+            go checkCommandInvocations(ssmClient, job.ID, commandID, targets, batch.Command)
         }
     }
 
-    // Redirect to the command status page
-    http.Redirect(w, r, "/command-status", http.StatusSeeOther)
+    return job, nil
+}
+
+// commandFinished reports whether an invocation status is final
+func commandFinished(status string) bool {
+    switch status {
+    case "Pending", "InProgress", "Delayed", "Cancelling":
+        return false
+    }
+    return true
 }
 
-// checkCommandStatus periodically checks the status of a command execution
-func checkCommandStatus(ssmClient *ssm.Client, commandID string, instanceID string, region string, command string) {
+// checkCommandInvocations periodically checks the status of a command on each of its instances.
+// It gives up on the remaining instances after 10 minutes without any change.
+func checkCommandInvocations(ssmClient *ssm.Client, jobID string, commandID string, instanceIDs []string, command string) {
     // Wait a few seconds before starting to check status
     time.Sleep(5 * time.Second)
-    
-    // Check status every 10 seconds for up to 10 minutes
-    for i := 0; i < 60; i++ {
-        status, output, err := aws.GetCommandStatus(ssmClient, commandID, instanceID)
-        if err != nil {
-            log.Printf("Error checking command status for instance %s: %v", instanceID, err)
-            updateCommandStatus(instanceID, "Error checking status", "", commandID, command)
-            return
+
+    pending := make(map[string]bool)
+    for _, instanceID := range instanceIDs {
+        pending[instanceID] = true
+    }
+    last := make(map[string]aws.CommandInvocation)
+
+    // Check status every 10 seconds, for up to 60 checks in a row without progress. A failed
+    // check, e.g. when throttled, counts as one without progress and is retried.
+    var checkErr error
+    for idle := 0; idle < 60; {
+        var invocations []aws.CommandInvocation
+        invocations, checkErr = aws.ListCommandInvocations(ssmClient, commandID)
+        if checkErr != nil {
+            log.Printf("Error checking status of command %s, retrying: %v", commandID, checkErr)
+            idle++
+            time.Sleep(10 * time.Second)
+            continue
         }
-        
-        // Update the status in our map
-        updateCommandStatus(instanceID, status, output, commandID, command)
-        
-        // If the command is no longer in progress, we're done
-        if status != "InProgress" && status != "Pending" {
+
+        progressed := false
+        for _, invocation := range invocations {
+            if !pending[invocation.InstanceID] || reflect.DeepEqual(last[invocation.InstanceID], invocation) {
+                continue
+            }
+            last[invocation.InstanceID] = invocation
+            progressed = true
+
+            // Update the status in the job, it is final once the command is no longer in progress
+            done := commandFinished(invocation.Status)
+            recordCommandInvocation(ssmClient, jobID, commandID, command, invocation, done)
+            if done {
+                delete(pending, invocation.InstanceID)
+            }
+        }
+
+        // Once every instance has a final status, we're done
+        if len(pending) == 0 {
             return
         }
-        
+        if progressed {
+            idle = 0
+        } else {
+            idle++
+        }
+
         // Wait before checking again
         time.Sleep(10 * time.Second)
     }
-    
-    // If we get here, the command has been running for too long
-    updateCommandStatus(instanceID, "Timeout", "", commandID, command)
+
+    // If we get here, the command has made no progress for too long, or its status could
+    // not be checked since
+    status := "Timeout"
+    if checkErr != nil {
+        status = "Error checking status"
+    }
+    for instanceID := range pending {
+        updateCommandStatus(jobID, instanceID, status, last[instanceID].Output, commandID, command, true)
+    }
 }
 
-// updateCommandStatus safely updates the commandStatusMap for a specific instance ID
-func updateCommandStatus(instanceID, status, output, commandID, command string) {
-    commandStatusLock.Lock()
-    defer commandStatusLock.Unlock()
-    commandStatusMap[instanceID] = CommandStatus{
-        Status:    status,
-        Output:    output,
-        Timestamp: time.Now().Format(time.RFC3339),
-        CommandID: commandID,
-        Command:   command,
+// recordCommandInvocation records the status, exit code and execution times of a command on an
+// instance. Once the command is done, its output and standard error are fetched, since the
+// invocation list only includes the first 2,500 characters of the output.
+func recordCommandInvocation(ssmClient *ssm.Client, jobID, commandID, command string, invocation aws.CommandInvocation, done bool) {
+    output, stderr := invocation.Output, ""
+    if done && invocation.ResponseCode != -1 {
+        var err error
+        output, stderr, err = aws.GetCommandOutput(ssmClient, commandID, invocation.InstanceID, invocation.PluginNames)
+        if err != nil {
+            log.Printf("Error fetching output of command %s on instance %s: %v", commandID, invocation.InstanceID, err)
+            output = invocation.Output
+        }
+    }
+
+    err := models.UpdateTask(jobID, invocation.InstanceID, func(task *models.Task) {
+        task.Status = invocation.Status
+        task.Output = output
+        task.Stderr = stderr
+        task.CommandID = commandID
+        task.Command = command
+        task.Done = done
+        if invocation.ResponseCode != -1 {
+            responseCode := invocation.ResponseCode
+            task.ResponseCode = &responseCode
+        }
+        if !invocation.StartedAt.IsZero() {
+            startedAt := invocation.StartedAt
+            task.ExecutionStartedAt = &startedAt
+        }
+        if !invocation.EndedAt.IsZero() {
+            endedAt := invocation.EndedAt
+            task.ExecutionEndedAt = &endedAt
+        }
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", invocation.InstanceID, jobID, err)
+    }
+}
+
+// commandOutputLocation returns the bucket and key prefix of command.output_bucket and
+// command.output_prefix, or an empty bucket when full output is not kept
+func commandOutputLocation() (string, string) {
+    if cfg == nil || cfg.Command.OutputBucket == "" {
+        return "", ""
+    }
+    prefix := strings.Trim(cfg.Command.OutputPrefix, "/")
+    if prefix == "" {
+        prefix = "command-output"
+    }
+    return cfg.Command.OutputBucket, prefix
+}
+
+// recordCommandSent records that a command was sent to an instance, and where the instance
+// writes its full output if an output bucket is configured
+func recordCommandSent(jobID, instanceID, commandID, command, outputBucket, outputPrefix string) {
+    err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+        task.Status = "Pending"
+        task.CommandID = commandID
+        task.Command = command
+        if outputBucket != "" {
+            task.OutputS3Bucket = outputBucket
+            task.OutputS3Prefix = outputPrefix + "/" + commandID + "/" + instanceID + "/"
+        }
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
     }
 }
 
-// GetCommandStatusMap provides a thread-safe way to access the commandStatusMap
-func GetCommandStatusMap() map[string]CommandStatus {
-    commandStatusLock.Lock()
-    defer commandStatusLock.Unlock()
-    // Create a copy to avoid concurrent modification issues
-    copyMap := make(map[string]CommandStatus)
-    for k, v := range commandStatusMap {
-        copyMap[k] = v
+// updateCommandStatus records the status and output of a command in the job's task for an instance
+func updateCommandStatus(jobID, instanceID, status, output, commandID, command string, done bool) {
+    err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+        task.Status = status
+        task.Output = output
+        task.CommandID = commandID
+        task.Command = command
+        task.Done = done
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
     }
-    return copyMap
 }
 
+// commandJobTypes are the job types shown on the command status page
+var commandJobTypes = []string{models.JobTypeCommand, models.JobTypeAutomation}
+
 // CommandStatusHandler renders the command status page
 func CommandStatusHandler(w http.ResponseWriter, r *http.Request) {
     isLoggedIn := auth.IsUserLoggedIn(r)
 
-    // Safely retrieve a copy of the commandStatusMap
-    currentStatusMap := GetCommandStatusMap()
-
-    // Map command statuses to EC2Instance objects for rendering
-    var instancesWithStatus []models.EC2Instance
-    for id, cmdStatus := range currentStatusMap {
-        instance, err := models.GetInstanceDetails(id)
-        if err != nil {
-            log.Printf("Error retrieving instance details for ID %s: %v", id, err)
-            continue
-        }
-
-        // Add status, output, and timestamp to the instance details
-        instance.State = cmdStatus.Status
-        instance.CommandOutput = cmdStatus.Output
-        instance.CommandTimestamp = cmdStatus.Timestamp
-        instance.Command = cmdStatus.Command
-        instancesWithStatus = append(instancesWithStatus, *instance)
+    jobs, err := loadJobs(r, commandJobTypes...)
+    if err != nil {
+        http.Error(w, "Failed to load jobs", http.StatusInternalServerError)
+        log.Printf("Error loading command jobs: %v", err)
+        return
     }
 
     // Prepare template data
     data := models.TemplateData{
         Title:     "Command Execution Status",
         IsLoggedIn: isLoggedIn,
-        Instances: instancesWithStatus,
         Version:   config.Version,
+        Data: map[string]interface{}{
+            "Jobs":  jobs,
+            "JobID": r.URL.Query().Get("job"),
+        },
     }
 
     // Load and parse the templates
-    tmpl, err := template.ParseFiles("templates/command_status.html", "templates/layout.html")
+    tmpl, err := template.ParseFiles("templates/command_status.html", "templates/task_events.html", "templates/layout.html")
     if err != nil {
         http.Error(w, "Failed to load template", http.StatusInternalServerError)
         log.Printf("Error loading templates: %v\n", err)
@@ -476,4 +793,196 @@ func CommandStatusHandler(w http.ResponseWriter, r *http.Request) {
         log.Printf("Error rendering command status page: %v\n", err)
         http.Error(w, "Error rendering command status page", http.StatusInternalServerError)
     }
-}
\ No newline at end of file
+}
+
+
+// errNothingToCancel is returned when none of the selected tasks has a command in flight
+var errNothingToCancel = errors.New("no command in flight to cancel")
+
+// CancelCommandHandler cancels the command of a job on one instance, or on all of its
+// instances when no instance is given
+func CancelCommandHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+        return
+    }
+
+    job, err := models.GetJob(r.FormValue("job"))
+    if err != nil || !slices.Contains(commandJobTypes, job.Type) || len(readableJob(r, job).Tasks) == 0 {
+        http.Error(w, "Command job not found", http.StatusNotFound)
+        return
+    }
+    instanceIDs := cancellableInstances(job, r.FormValue("instance"))
+    if len(instanceIDs) == 0 {
+        http.Error(w, errNothingToCancel.Error(), http.StatusConflict)
+        return
+    }
+    if !requireInstancePermission(w, r, models.ActionCommand, instanceIDs) {
+        return
+    }
+
+    if err := cancelCommandTasks(job, instanceIDs, auth.GetUserName(r)); err != nil {
+        http.Error(w, "Failed to cancel command on some instances", http.StatusBadGateway)
+        log.Printf("Error cancelling command job %s: %v", job.ID, err)
+        return
+    }
+
+    http.Redirect(w, r, "/command-status?job="+job.ID, http.StatusSeeOther)
+}
+
+// cancellableInstances returns the instances of a job whose command or automation is still in
+// flight, limited to instanceID if it is not empty
+func cancellableInstances(job *models.Job, instanceID string) []string {
+    var instanceIDs []string
+    for _, task := range job.Tasks {
+        if (instanceID == "" || task.InstanceID == instanceID) && !task.Done && (task.CommandID != "" || task.AutomationID != "") {
+            instanceIDs = append(instanceIDs, task.InstanceID)
+        }
+    }
+    return instanceIDs
+}
+
+// cancelCommandTasks calls SSM CancelCommand for the instances of a job, once per account,
+// region and command, or stops the Automation execution of each instance, and records who
+// cancelled on their tasks. The pollers then record the Cancelled status once SSM reports it.
+func cancelCommandTasks(job *models.Job, instanceIDs []string, user string) error {
+    var batches []*commandBatch
+    batchIndex := make(map[string]*commandBatch)
+    for _, task := range job.Tasks {
+        if !slices.Contains(instanceIDs, task.InstanceID) {
+            continue
+        }
+        // Each instance has an Automation execution of its own
+        commandID := task.CommandID
+        if task.AutomationID != "" {
+            commandID = task.AutomationID
+        }
+        key := strings.Join([]string{task.AWSAccountNumber, task.Region, commandID}, "\x00")
+        batch := batchIndex[key]
+        if batch == nil {
+            batch = &commandBatch{AccountNumber: task.AWSAccountNumber, Region: task.Region, CommandID: commandID}
+            batchIndex[key] = batch
+            batches = append(batches, batch)
+        }
+        batch.InstanceIDs = append(batch.InstanceIDs, task.InstanceID)
+    }
+
+    var failed []error
+    assumedConfigs := make(map[string]awssdk.Config)
+    for _, batch := range batches {
+        assumedConfig, assumed := assumedConfigs[batch.AccountNumber]
+        if !assumed {
+            var err error
+            assumedConfig, err = aws.AssumeRoleInAccount(command_role_name, batch.AccountNumber)
+            if err != nil {
+                failed = append(failed, err)
+                continue
+            }
+            assumedConfigs[batch.AccountNumber] = assumedConfig
+        }
+        ssmClient, err := aws.NewSSMClient(assumedConfig, batch.Region)
+        if err != nil {
+            failed = append(failed, err)
+            continue
+        }
+        if job.Type == models.JobTypeAutomation {
+            err = aws.StopAutomation(ssmClient, batch.CommandID)
+        } else {
+            err = aws.CancelSSMCommand(ssmClient, batch.CommandID, batch.InstanceIDs)
+        }
+        if err != nil {
+            failed = append(failed, err)
+            continue
+        }
+
+        log.Printf("%s cancelled command %s of job %s on %v", user, batch.CommandID, job.ID, batch.InstanceIDs)
+        for _, instanceID := range batch.InstanceIDs {
+            err := models.UpdateTask(job.ID, instanceID, func(task *models.Task) {
+                if !task.Done {
+                    task.Status = "Cancelling"
+                }
+                task.CancelledBy = user
+            })
+            if err != nil {
+                log.Printf("Error updating task for instance %s in job %s: %v", instanceID, job.ID, err)
+            }
+        }
+    }
+    return errors.Join(failed...)
+}
+
+// CommandOutputHandler shows or downloads the full stdout or stderr of a command on an instance
+func CommandOutputHandler(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    task, err := findJobTask(r, query.Get("job"), query.Get("instance"))
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    stream := query.Get("stream")
+    if stream == "" {
+        stream = "stdout"
+    }
+    if stream != "stdout" && stream != "stderr" {
+        http.Error(w, "Unsupported output stream", http.StatusBadRequest)
+        return
+    }
+
+    content, truncated := commandTaskOutput(task, stream)
+
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    if truncated {
+        w.Header().Set("X-Output-Truncated", "true")
+    }
+    if query.Get("download") != "" {
+        w.Header().Set("Content-Disposition", `attachment; filename="`+task.InstanceID+`-`+task.CommandID+`-`+stream+`.txt"`)
+    }
+    w.Write(content)
+}
+
+// findJobTask returns the task of an instance within a job. Tasks the caller may not see are
+// reported as not part of the job.
+func findJobTask(r *http.Request, jobID, instanceID string) (models.Task, error) {
+    job, err := models.GetJob(jobID)
+    if err != nil {
+        return models.Task{}, fmt.Errorf("job not found")
+    }
+    for _, task := range job.Tasks {
+        if task.InstanceID == instanceID && canReadTask(r, task) {
+            return task, nil
+        }
+    }
+    return models.Task{}, fmt.Errorf("instance not part of job")
+}
+
+// outputTruncatedNote ends output that could not be loaded in full from S3
+const outputTruncatedNote = "\n[Output truncated by SSM: the full output could not be loaded from S3]\n"
+
+// commandTaskOutput returns the stdout or stderr of a command on an instance, in full from the
+// S3 output location if there is one, or else as truncated by SSM. If S3 fails, the output
+// truncated by SSM is returned with outputTruncatedNote and truncated set.
+func commandTaskOutput(task models.Task, stream string) (content []byte, truncated bool) {
+    if task.OutputS3Bucket != "" {
+        content, err := aws.GetCommandOutputFromS3(task.OutputS3Bucket, task.OutputS3Prefix, stream)
+        if err != nil {
+            log.Printf("Error loading %s of command %s on instance %s from S3, falling back to the output returned by SSM: %v",
+                stream, task.CommandID, task.InstanceID, err)
+            truncated = true
+        } else if content != nil {
+            return content, false
+        }
+    }
+    if stream == "stderr" {
+        content = []byte(task.Stderr)
+    } else {
+        content = []byte(task.Output)
+    }
+    if truncated {
+        content = append(content, outputTruncatedNote...)
+    }
+    return content, truncated
+}
@@ -58,6 +58,10 @@ func ConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Handle form submission
 	if r.Method == http.MethodPost {
+		if !auth.Can(r, models.ActionSchedule) {
+			http.Error(w, "Not allowed to change the schedule", http.StatusForbidden)
+			return
+		}
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "Failed to parse form data", http.StatusBadRequest)
 			return
@@ -93,7 +97,8 @@ func ConfigHandler(w http.ResponseWriter, r *http.Request) {
 		Data: map[string]interface{}{
 			"ScheduleConfig": scheduleConfig,
 			"Updated":        r.URL.Query().Get("updated") == "true",
-			"Days":           []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"},
+			"Days":           scheduleDays,
+			"CanEdit":        auth.Can(r, models.ActionSchedule),
 		},
 	}
 
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"ec2-restart-manager/models"
+)
+
+// Interval of comment lines that keep idle event streams open through proxies
+const eventKeepAlive = 30 * time.Second
+
+// EventsHandler streams changes of the tasks the caller may see as Server-Sent Events. The job
+// and instance query parameters restrict the stream to one job or one instance. A stream starts
+// with the current state of the tasks that may have changed since the client last saw them, and
+// ends if the client falls behind, so that the browser reconnects and catches up.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	jobID := r.URL.Query().Get("job")
+	instanceID := r.URL.Query().Get("instance")
+	streamed := func(event models.TaskEvent) bool {
+		return (jobID == "" || event.JobID == jobID) && (instanceID == "" || event.Task.InstanceID == instanceID) &&
+			canReadTask(r, event.Task)
+	}
+
+	// Subscribe before reading the snapshot so that no change is missed in between
+	events, unsubscribe := models.SubscribeTaskEvents()
+	defer unsubscribe()
+
+	snapshot, err := taskSnapshot(jobID, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for _, event := range snapshot {
+		if streamed(event) {
+			writeTaskEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, open := <-events:
+			if !open {
+				// Fell behind; the browser reconnects with the ID of the last event it received
+				return
+			}
+			if !streamed(event) {
+				continue
+			}
+			writeTaskEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+// taskSnapshot returns the current state of the tasks a stream starts with: every task of the
+// job for a job stream, otherwise the tasks of jobs still running or that ended after the
+// event the client last received before reconnecting
+func taskSnapshot(jobID, lastEventID string) ([]models.TaskEvent, error) {
+	var jobs []*models.Job
+	if jobID != "" {
+		job, err := models.GetJob(jobID)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	} else {
+		var err error
+		if jobs, err = models.ListJobs(); err != nil {
+			log.Printf("Error loading jobs for task events: %v", err)
+		}
+	}
+	lastSeen, _ := time.Parse(time.RFC3339Nano, lastEventID)
+
+	var snapshot []models.TaskEvent
+	for _, job := range jobs {
+		if jobID == "" && job.State != models.JobStateRunning && (lastEventID == "" || !job.EndedAt.After(lastSeen)) {
+			continue
+		}
+		for _, task := range job.Tasks {
+			snapshot = append(snapshot, models.TaskEvent{JobID: job.ID, JobState: job.State, Task: task})
+		}
+	}
+	return snapshot, nil
+}
+
+// writeTaskEvent writes a task change as a "task" event with a JSON payload. The ID is the time
+// of the change, which the browser sends back as Last-Event-ID when it reconnects.
+func writeTaskEvent(w http.ResponseWriter, event models.TaskEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshalling task event: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: task\ndata: %s\n\n", event.Task.UpdatedAt.Format(time.RFC3339Nano), payload)
+}
@@ -1,31 +1,155 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
 
-	"ec2-restart-manager/aws"
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/inventory"
 	"ec2-restart-manager/models"
 	"ec2-restart-manager/utils"
 )
 
-// updateInstancesFromS3 fetches and loads the latest instances from S3
-func updateInstancesFromS3(bucket, key string) error {
-	// Fetch CSV from S3
-	csvContent, err := aws.GetCSVFromS3(bucket, key)
+var inventoryRefresher *inventory.Refresher
+
+// InjectInventoryRefresher allows main.go to pass the background inventory refresher
+func InjectInventoryRefresher(refresher *inventory.Refresher) {
+	inventoryRefresher = refresher
+}
+
+// deniedInstances returns the instances the caller may not perform action on. Unknown
+// instances are denied, since their account and environment cannot be checked.
+func deniedInstances(r *http.Request, action string, instanceIDs []string) []string {
+	var denied []string
+	for _, instanceID := range instanceIDs {
+		instance, err := models.GetInstanceDetails(instanceID)
+		if err != nil || !auth.CanOn(r, action, *instance) {
+			denied = append(denied, instanceID)
+		}
+	}
+	return denied
+}
+
+// requireInstancePermission answers with 403 Forbidden unless the caller may perform
+// action on every instance
+func requireInstancePermission(w http.ResponseWriter, r *http.Request, action string, instanceIDs []string) bool {
+	if denied := deniedInstances(r, action, instanceIDs); len(denied) > 0 {
+		log.Printf("%s denied %s on %v", auth.GetUserName(r), action, denied)
+		http.Error(w, "Not allowed to "+action+" instances: "+strings.Join(denied, ", "), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// selectedInstanceIDs returns the instances chosen on the index page: the checked
+// instance_ids or, when select_all is set because all matching instances across pages were
+// selected, every readable instance matching the filters in select_filter. An empty
+// select_filter selects every readable instance.
+func selectedInstanceIDs(r *http.Request) ([]string, error) {
+	if r.FormValue("select_all") == "" {
+		return r.Form["instance_ids"], nil
+	}
+	query, err := url.ParseQuery(r.FormValue("select_filter"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid select_filter: %w", err)
+	}
+	filter, err := utils.ParseInstanceFilter(query)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var instanceIDs []string
+	for _, instance := range utils.FilterInstances(readableInstances(r, models.GetInstances()), filter) {
+		instanceIDs = append(instanceIDs, instance.ID)
+	}
+	return instanceIDs, nil
+}
 
-	// Parse CSV into instances
-	instances, err := utils.ParseCSVToStruct(csvContent)
+// readableInstances returns the instances the caller may see
+func readableInstances(r *http.Request, instances []models.EC2Instance) []models.EC2Instance {
+	var readable []models.EC2Instance
+	for _, instance := range instances {
+		if auth.CanOn(r, models.ActionRead, instance) {
+			readable = append(readable, instance)
+		}
+	}
+	return readable
+}
+
+// canReadInstance checks if the caller may see an instance. An instance that has left the
+// inventory is checked against the account name recorded with it, so only grants without
+// environment, service or owner filters still cover it.
+func canReadInstance(r *http.Request, instanceID, accountName string) bool {
+	instance, err := models.GetInstanceDetails(instanceID)
 	if err != nil {
-		return err
+		instance = &models.EC2Instance{ID: instanceID, AWSAccountName: accountName}
+	}
+	return auth.CanOn(r, models.ActionRead, *instance)
+}
+
+// canReadTask checks if the caller may see a task of a job
+func canReadTask(r *http.Request, task models.Task) bool {
+	return canReadInstance(r, task.InstanceID, task.AWSAccountName)
+}
+
+// readableJob returns a copy of the job reduced to the tasks the caller may see, and the
+// batches of a rollout to their instances
+func readableJob(r *http.Request, job *models.Job) *models.Job {
+	readable := *job
+	readable.Tasks = nil
+	visible := make(map[string]bool)
+	for _, task := range job.Tasks {
+		if canReadTask(r, task) {
+			readable.Tasks = append(readable.Tasks, task)
+			visible[task.InstanceID] = true
+		}
 	}
 
-	// Load parsed instances into global cache
-	models.LoadInstances(instances)
-    if utils.Debug {
-		log.Printf("Instances successfully loaded from S3: %d", len(instances))
+	if job.Rollout != nil {
+		rollout := *job.Rollout
+		rollout.Batches = make([]models.RolloutBatch, 0, len(job.Rollout.Batches))
+		for _, batch := range job.Rollout.Batches {
+			var instanceIDs []string
+			for _, instanceID := range batch.InstanceIDs {
+				if visible[instanceID] {
+					instanceIDs = append(instanceIDs, instanceID)
+				}
+			}
+			batch.InstanceIDs = instanceIDs
+			rollout.Batches = append(rollout.Batches, batch)
+		}
+		readable.Rollout = &rollout
 	}
-	return nil
+	return &readable
+}
+
+// readableJobs returns the jobs reduced to the tasks the caller may see, leaving out jobs
+// without any such task
+func readableJobs(r *http.Request, jobs []*models.Job) []*models.Job {
+	var readable []*models.Job
+	for _, job := range jobs {
+		if job = readableJob(r, job); len(job.Tasks) > 0 {
+			readable = append(readable, job)
+		}
+	}
+	return readable
+}
+
+// RefreshInventoryHandler reloads the inventory now instead of waiting for the next
+// background refresh
+func RefreshInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := inventoryRefresher.Refresh(); err != nil {
+		http.Error(w, "Failed to update instance data", http.StatusInternalServerError)
+		log.Printf("Error refreshing inventory: %v", err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
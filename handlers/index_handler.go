@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"html/template"
 	"log"
+	"strconv"
 	"ec2-restart-manager/config"
 	"ec2-restart-manager/models"
 	"ec2-restart-manager/utils"
@@ -27,72 +29,83 @@ func init() {
 
 // Updated code for IndexHandler in index_handler.go
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	// Fetch and load instances from S3
-	if err := updateInstancesFromS3(cfg.S3.Bucket, cfg.S3.Key); err != nil {
-		http.Error(w, "Failed to update instance data", http.StatusInternalServerError)
-		log.Printf("Error updating instances: %v", err)
-		return
-	}
-
-	// Retrieve instances from the global cache
-	instances := models.GetInstances()
-
-	// Extract unique values for filters
-	uniqueOwners := utils.GetUniqueOwners(instances)
-	uniqueServices := utils.GetUniqueServices(instances)
-	uniqueAWSAccountNames := utils.GetUniqueAWSAccountNames(instances)
-	uniqueRegions := utils.GetUniqueRegions(instances)
+	// Retrieve the instances the user may see from the global cache
+	instances := readableInstances(r, models.GetInstances())
 
-	// Initialize variables for filtering
-	filteredInstances := instances
-	selectedOwner := ""
-	selectedService := ""
-	selectedAWSAccountName := ""
-	selectedRegion := ""
-
-	// Handle filtering based on user input
+	// The filters come from the query string, so that a filtered view can be bookmarked
 	if r.Method == http.MethodPost {
-		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Failed to parse form data", http.StatusBadRequest)
-			log.Printf("Error parsing form data: %v", err)
-			return
-		}
+		redirectToFilteredView(w, r)
+		return
+	}
+	// An invalid filter expression shows no instances, so that bulk actions cannot act on
+	// more instances than intended; other invalid filter parameters are rejected
+	filter, queryErr := utils.ParseInstanceFilter(r.URL.Query())
+	var expressionErr *utils.QueryError
+	if queryErr != nil && !errors.As(queryErr, &expressionErr) {
+		http.Error(w, queryErr.Error(), http.StatusBadRequest)
+		return
+	}
+	var filteredInstances []models.EC2Instance
+	if queryErr == nil {
+		filteredInstances = utils.FilterInstances(instances, filter)
+	}
 
-		// Retrieve selected filter values from the form
-		selectedOwner = r.FormValue("owner")
-		selectedService = r.FormValue("service")
-		selectedAWSAccountName = r.FormValue("awsAccountName")
-		selectedRegion = r.FormValue("region")
+	// Only one page of the sorted instances is rendered; bulk actions can still select
+	// every matching instance
+	order := utils.ParseInstanceOrder(r.URL.Query())
+	utils.SortInstances(filteredInstances, order)
+	page := utils.ParseInstancePage(r.URL.Query(), len(filteredInstances))
+	pageInstances := page.Slice(filteredInstances)
 
-		// Apply filters to the instances
-		filteredInstances = utils.FilterInstances(instances, selectedOwner, selectedService, selectedAWSAccountName, selectedRegion)
+	filters := []filterField{
+		newFilterField("account", "AWS Account Name", utils.GetUniqueAWSAccountNames(instances), filter.AWSAccountNames),
+		newFilterField("service", "Service", utils.GetUniqueServices(instances), filter.Services),
+		newFilterField("owner", "Owner", utils.GetUniqueOwners(instances), filter.Owners),
+		newFilterField("region", "Region", utils.GetUniqueRegions(instances), filter.Regions),
+		newFilterField("environment_class", "Environment Class", utils.GetUniqueEnvironmentClasses(instances), filter.EnvironmentClasses),
+	}
+	var tagFilters []filterField
+	for _, tag := range utils.GetUniqueTagValues(instances, cfg.Inventory.FilterColumns) {
+		tagFilters = append(tagFilters, newFilterField("tag:"+tag.Name, tag.Name, tag.Values, filter.Tags[tag.Name]))
 	}
 
-	// Check if the user is logged in by looking for the session ID cookie
-	sessionID, err := r.Cookie("session_id")
-	isLoggedIn := err == nil && auth.SessionStore[sessionID.Value] != ""
-
-	// Retrieve the user's name from the session store if logged in
+	// Check if the user is logged in, and retrieve their name from the session store
+	isLoggedIn := auth.IsUserLoggedIn(r)
 	userName := ""
 	if isLoggedIn {
-		userName = auth.SessionStore[sessionID.Value]
+		userName = auth.GetUserName(r)
 	}
 
 	// Prepare data to pass to the template
 	data := models.TemplateData{
 		Title:                 "EC2 Instance Manager",
 		Version:			   config.Version,
-		Instances:             filteredInstances,
-		UniqueOwners:          uniqueOwners,
-		SelectedOwner:         selectedOwner,
-		UniqueServices:        uniqueServices,
-		SelectedService:       selectedService,
-		UniqueAWSAccountNames: uniqueAWSAccountNames,
-		SelectedAWSAccountName: selectedAWSAccountName,
-		UniqueRegions:         uniqueRegions,
-		SelectedRegion:        selectedRegion,
+		Instances:             pageInstances,
 		IsLoggedIn:            isLoggedIn, // Pass login status to the template
 		UserName:              userName,   // Pass the user’s name to the template
+		Data: map[string]interface{}{
+			"CanRestart":   auth.Can(r, models.ActionRestart),
+			"CanCommand":   auth.Can(r, models.ActionCommand),
+			"Library":      usableLibraryCommands(r),
+			"Documents":    usableDocuments(r),
+			"Allowed":      allowedActions(r, pageInstances),
+			"AllowedAll":   allowedOnAll(r, filteredInstances),
+			"Inventory":    inventoryRefresher.Status(),
+			"Filters":      filters,
+			"TagFilters":   tagFilters,
+			"Filter":       filter,
+			"QueryText":    r.URL.Query().Get("query"),
+			"QueryError":   queryErr,
+			"Views":        savedViewOptions(r, filter),
+			"FilterParams": filter.Query().Encode(),
+			"Total":        len(instances),
+			"Matching":     len(filteredInstances),
+			"Columns":      tableColumns(filter, order, page),
+			"Order":        order,
+			"Page":         page,
+			"PageLinks":    pageLinks(filter, order, page),
+			"PageSizes":    pageSizeLinks(filter, order, page),
+		},
 	}
 
 	// Render layout.html with index.html as the content
@@ -102,5 +115,164 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// filterOption is a value offered by a filter of the index page
+type filterOption struct {
+	Value    string
+	Selected bool
+}
+
+// filterField is a multi-select filter of the index page and the query parameter it sets
+type filterField struct {
+	Param   string
+	Label   string
+	Options []filterOption
+}
+
+// newFilterField offers values, marking the selected ones. Selected values that no longer
+// occur are still offered so that they can be deselected.
+func newFilterField(param, label string, values, selected []string) filterField {
+	field := filterField{Param: param, Label: label}
+	for _, value := range values {
+		field.Options = append(field.Options, filterOption{Value: value, Selected: containsString(selected, value)})
+	}
+	for _, value := range selected {
+		if !containsString(values, value) {
+			field.Options = append(field.Options, filterOption{Value: value, Selected: true})
+		}
+	}
+	return field
+}
+
+// redirectToFilteredView turns the filter form of earlier versions, which was posted, into
+// a bookmarkable query string
+func redirectToFilteredView(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		log.Printf("Error parsing form data: %v", err)
+		return
+	}
+	form := r.PostForm
+	if accounts, exists := form["awsAccountName"]; exists {
+		form["account"] = accounts
+	}
+	filter, err := utils.ParseInstanceFilter(form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/?"+filter.Query().Encode(), http.StatusSeeOther)
+}
+
+// allowedActions maps each instance ID to the actions the user may perform on it, so that
+// the page only offers buttons that will be accepted
+func allowedActions(r *http.Request, instances []models.EC2Instance) map[string]map[string]bool {
+	allowed := make(map[string]map[string]bool)
+	for _, instance := range instances {
+		allowed[instance.ID] = map[string]bool{
+			models.ActionRestart: auth.CanOn(r, models.ActionRestart, instance),
+			models.ActionCommand: auth.CanOn(r, models.ActionCommand, instance),
+		}
+	}
+	return allowed
+}
+
+// allowedOnAll reports for each action if the user may perform it on every instance, so
+// that the page can offer it for all matching instances across pages
+func allowedOnAll(r *http.Request, instances []models.EC2Instance) map[string]bool {
+	allowed := map[string]bool{models.ActionRestart: true, models.ActionCommand: true}
+	for _, instance := range instances {
+		for action := range allowed {
+			allowed[action] = allowed[action] && auth.CanOn(r, action, instance)
+		}
+	}
+	return allowed
+}
+
+// tableColumn is a column of the instance table and the link sorting by it
+type tableColumn struct {
+	Label      string
+	URL        string
+	Sorted     bool
+	Descending bool
+}
+
+// Instance table columns and the fields they show
+var instanceColumns = []struct{ label, field string }{
+	{"AWS Account Name", "aws_account_name"},
+	{"State", "state"},
+	{"Uptime Days", "uptime_days"},
+	{"Name", "name"},
+	{"Instance ID", "id"},
+	{"Service", "service"},
+	{"Owner", "owner"},
+	{"Region", "region"},
+	{"Source", "source"},
+}
+
+// tableColumns links each column to the first page sorted by it, reversing the order of
+// the column currently sorted by
+func tableColumns(filter utils.InstanceFilter, order utils.InstanceOrder, page utils.InstancePage) []tableColumn {
+	var columns []tableColumn
+	for _, column := range instanceColumns {
+		sorted := order.Field == column.field
+		columnOrder := utils.InstanceOrder{Field: column.field, Descending: sorted && !order.Descending}
+		columns = append(columns, tableColumn{
+			Label:      column.label,
+			URL:        indexURL(filter, columnOrder, 1, page.Size),
+			Sorted:     sorted,
+			Descending: order.Descending,
+		})
+	}
+	return columns
+}
+
+// pageLink is a link to a page of the instance table; Number 0 marks a gap
+type pageLink struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+// pageLinks links to the first, last and nearby pages
+func pageLinks(filter utils.InstanceFilter, order utils.InstanceOrder, page utils.InstancePage) []pageLink {
+	var links []pageLink
+	for number := 1; number <= page.Pages(); number++ {
+		if number != 1 && number != page.Pages() && (number < page.Number-2 || number > page.Number+2) {
+			if links[len(links)-1].Number != 0 {
+				links = append(links, pageLink{})
+			}
+			continue
+		}
+		links = append(links, pageLink{
+			Number:  number,
+			URL:     indexURL(filter, order, number, page.Size),
+			Current: number == page.Number,
+		})
+	}
+	return links
+}
 
+// pageSizeLinks links to the first page of each page size, marking the current size
+func pageSizeLinks(filter utils.InstanceFilter, order utils.InstanceOrder, page utils.InstancePage) []pageLink {
+	var links []pageLink
+	for _, size := range utils.PageSizes {
+		links = append(links, pageLink{Number: size, URL: indexURL(filter, order, 1, size), Current: size == page.Size})
+	}
+	return links
+}
 
+// indexURL is the index page showing a page of the filtered and sorted instances. The
+// default page and page size are left out of the URL.
+func indexURL(filter utils.InstanceFilter, order utils.InstanceOrder, page, size int) string {
+	query := filter.Query()
+	for key, values := range order.Query() {
+		query[key] = values
+	}
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if size != utils.PageSizes[0] {
+		query.Set("per_page", strconv.Itoa(size))
+	}
+	return "/?" + query.Encode()
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+)
+
+// InventoryChangesHandler renders the instances added, removed and changed by recent
+// inventory loads
+func InventoryChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Redirect(w, r, "/access_denied", http.StatusFound)
+		return
+	}
+
+	data := models.TemplateData{
+		Title:      "Inventory Changes",
+		IsLoggedIn: auth.IsUserLoggedIn(r),
+		UserName:   auth.GetUserName(r),
+		Version:    config.Version,
+		Data: map[string]interface{}{
+			"Diffs":     readableDiffs(r, models.ListInventoryDiffs()),
+			"Inventory": inventoryRefresher.Status(),
+		},
+	}
+
+	tmpl, err := template.ParseFiles("templates/inventory_changes.html", "templates/layout.html")
+	if err != nil {
+		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		log.Printf("Error loading templates: %v\n", err)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error rendering inventory changes page: %v\n", err)
+		http.Error(w, "Error rendering inventory changes page", http.StatusInternalServerError)
+	}
+}
+
+// InventoryEventsHandler streams inventory diffs as Server-Sent Events, restricted to the
+// instances the caller may see
+func InventoryEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Error(w, "Not allowed to read the inventory", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := models.SubscribeInventoryEvents()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case diff, open := <-events:
+			if !open {
+				return
+			}
+			diffs := readableDiffs(r, []models.InventoryDiff{diff})
+			if len(diffs) == 0 {
+				continue
+			}
+			writeInventoryEvent(w, diffs[0])
+			flusher.Flush()
+		}
+	}
+}
+
+// writeInventoryEvent writes a diff as an "inventory" event with a JSON payload
+func writeInventoryEvent(w http.ResponseWriter, diff models.InventoryDiff) {
+	payload, err := json.Marshal(diff)
+	if err != nil {
+		log.Printf("Error marshalling inventory event: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "event: inventory\ndata: %s\n\n", payload)
+}
+
+// readableDiffs returns the diffs reduced to the changes of instances the caller may see,
+// before or after the change, leaving out diffs without any such change
+func readableDiffs(r *http.Request, diffs []models.InventoryDiff) []models.InventoryDiff {
+	var readable []models.InventoryDiff
+	for _, diff := range diffs {
+		var changes []models.InventoryChange
+		for _, change := range diff.Changes {
+			if auth.CanOn(r, models.ActionRead, change.Instance.EC2Instance) ||
+				(change.Previous != nil && auth.CanOn(r, models.ActionRead, *change.Previous)) {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) > 0 {
+			diff.Changes = changes
+			readable = append(readable, diff)
+		}
+	}
+	return readable
+}
@@ -0,0 +1,186 @@
+// handlers/report_handler.go
+package handlers
+
+import (
+	"encoding/csv"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+	"ec2-restart-manager/utils"
+)
+
+// Uptime threshold when report.uptime_threshold_days is not set
+const defaultUptimeThresholdDays = 90
+
+// Days back the uptime report compares with by default
+const defaultUptimeCompareDays = 7
+
+// Days back the uptime report offers to compare with
+var uptimeCompareDays = []int{1, 7, 30, 90}
+
+// uptimeReportRequest is an uptime report and the parameters it was built with
+type uptimeReportRequest struct {
+	Report       utils.UptimeReport
+	Filter       utils.InstanceFilter
+	CompareDays  int
+	ComparedWith *models.UptimeSnapshot // Nil without an earlier snapshot
+}
+
+// UptimeReportHandler renders the uptime and restart-hygiene report
+func UptimeReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Redirect(w, r, "/access_denied", http.StatusFound)
+		return
+	}
+
+	request, err := buildUptimeReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := models.TemplateData{
+		Title:      "Uptime Report",
+		IsLoggedIn: auth.IsUserLoggedIn(r),
+		UserName:   auth.GetUserName(r),
+		Version:    config.Version,
+		Data: map[string]interface{}{
+			"Report":       request.Report,
+			"CompareDays":  request.CompareDays,
+			"CompareWith":  uptimeCompareDays,
+			"ComparedWith": request.ComparedWith,
+			"Query":        r.URL.Query(),
+			"InstancesURL": overThresholdURL(request),
+			"GroupsCSV":    uptimeExportURL(r, "groups"),
+			"InstancesCSV": uptimeExportURL(r, "instances"),
+		},
+	}
+
+	tmpl, err := template.ParseFiles("templates/uptime_report.html", "templates/layout.html")
+	if err != nil {
+		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		log.Printf("Error loading templates: %v\n", err)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Printf("Error rendering uptime report: %v\n", err)
+		http.Error(w, "Error rendering uptime report", http.StatusInternalServerError)
+	}
+}
+
+// UptimeReportExportHandler exports the groups of the uptime report, or the instances
+// over the threshold, as CSV
+func UptimeReportExportHandler(w http.ResponseWriter, r *http.Request) {
+	if !auth.Can(r, models.ActionRead) {
+		http.Error(w, "Not allowed to read the uptime report", http.StatusForbidden)
+		return
+	}
+
+	request, err := buildUptimeReport(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report := request.Report
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != "groups" && kind != "instances" {
+		http.Error(w, "Unsupported export kind", http.StatusBadRequest)
+		return
+	}
+	if kind == "" {
+		kind = "groups"
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="uptime-`+kind+`.csv"`)
+	writer := csv.NewWriter(w)
+	if kind == "instances" {
+		writer.Write([]string{"Instance ID", "Name", "Uptime Days", "Service", "Owner", "Account Name", "Environment Class", "Region"})
+		for _, instance := range report.OverThreshold {
+			writer.Write([]string{instance.ID, instance.EC2Name, instance.UptimeDays, instance.Service, instance.Owner,
+				instance.AWSAccountName, instance.EnvironmentClass, instance.Region})
+		}
+	} else {
+		writer.Write([]string{"Dimension", "Group", "Instances", "P50 Days", "P90 Days", "Max Days",
+			"Over " + strconv.Itoa(report.ThresholdDays) + " Days", "Owners Over Threshold",
+			"Previous P50 Days", "Previous Over Threshold"})
+		for _, dimension := range report.Dimensions {
+			for _, group := range dimension.Groups {
+				current := group.Trend.Current
+				previousP50, previousOver := "", ""
+				if previous := group.Trend.Previous; previous != nil {
+					previousP50, previousOver = strconv.Itoa(previous.P50), strconv.Itoa(previous.OverThreshold)
+				}
+				writer.Write([]string{dimension.Field, group.Name, strconv.Itoa(current.Instances),
+					strconv.Itoa(current.P50), strconv.Itoa(current.P90), strconv.Itoa(current.Max),
+					strconv.Itoa(current.OverThreshold), strings.Join(group.Owners, "; "), previousP50, previousOver})
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing uptime report CSV export: %v", err)
+	}
+}
+
+// buildUptimeReport builds the uptime report of the readable instances matching the
+// filter parameters, comparing with the snapshot of compare days ago if there is one.
+// The threshold parameter overrides the configured threshold.
+func buildUptimeReport(r *http.Request) (uptimeReportRequest, error) {
+	query := r.URL.Query()
+	filter, err := utils.ParseInstanceFilter(query)
+	if err != nil {
+		return uptimeReportRequest{}, err
+	}
+
+	threshold := cfg.Report.UptimeThresholdDays
+	if threshold <= 0 {
+		threshold = defaultUptimeThresholdDays
+	}
+	if days, err := strconv.Atoi(query.Get("threshold")); err == nil && days > 0 {
+		threshold = days
+	}
+	request := uptimeReportRequest{Filter: filter, CompareDays: defaultUptimeCompareDays}
+	if days, err := strconv.Atoi(query.Get("compare")); err == nil && days > 0 {
+		request.CompareDays = days
+	}
+
+	instances := utils.FilterInstances(readableInstances(r, models.GetInstances()), filter)
+	var previous []models.EC2Instance
+	snapshot, err := models.FindUptimeSnapshot(time.Now(), request.CompareDays)
+	if err != nil {
+		log.Printf("Error loading uptime snapshots: %v", err)
+	} else if snapshot != nil {
+		request.ComparedWith = snapshot
+		previous = utils.FilterInstances(readableInstances(r, snapshot.EC2Instances()), filter)
+		if previous == nil {
+			previous = []models.EC2Instance{}
+		}
+	}
+
+	request.Report = utils.BuildUptimeReport(instances, previous, threshold)
+	return request, nil
+}
+
+// overThresholdURL links to the instance list showing the instances over the threshold
+func overThresholdURL(request uptimeReportRequest) string {
+	filter := request.Filter
+	filter.MinUptimeDays = float64(request.Report.ThresholdDays)
+	return "/?" + filter.Query().Encode()
+}
+
+// uptimeExportURL builds the CSV export link of the current report
+func uptimeExportURL(r *http.Request, kind string) string {
+	query := r.URL.Query()
+	query.Set("kind", kind)
+	return "/reports/uptime.csv?" + query.Encode()
+}
@@ -1,29 +1,37 @@
 package handlers
 
 import (
+    "errors"
     "fmt"
     "log"
     "net/http"
-    "sync"
     "time"
 
+    "ec2-restart-manager/auth"
     "ec2-restart-manager/aws"
     "ec2-restart-manager/models"
+    "github.com/aws/aws-sdk-go-v2/service/ec2"
 )
 
 var restarter_role_name = "ec2-restart-manager-restarter"
 
-// Mutex to handle concurrent access to the status map
-var statusLock sync.Mutex
+// Phases reported on the status page while a restart is tracked until healthy
+const (
+    phaseRebooting          = "Rebooting"
+    phaseChecksInitializing = "Checks initializing"
+    phaseChecksImpaired     = "Checks impaired"
+    phaseHealthy            = "Healthy"
+    phaseUnhealthyTimeout   = "Unhealthy after timeout"
+)
 
-// Struct to store the status and timestamp of each instance restart operation
-type InstanceStatus struct {
-    Status    string // e.g., "Success" or "Failed"
-    Timestamp string // ISO 8601 format timestamp
-}
+// Default time to wait for status checks when restart.health_timeout_minutes is not set
+const defaultHealthTimeout = 15 * time.Minute
 
-// Map to store the status of each instance restart operation
-var statusMap = make(map[string]InstanceStatus)
+// Checks still reporting ok this long after the reboot are trusted as post-reboot results
+const healthSettlePeriod = 2 * time.Minute
+
+// statusUpdater records the status of one instance's task; done marks the status as final
+type statusUpdater func(status string, done bool)
 
 // RestartHandler handles the request to restart EC2 instances in multiple accounts/regions
 func RestartHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,84 +41,183 @@ func RestartHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    instanceIDs := r.Form["instance_ids"]
+    instanceIDs, err := selectedInstanceIDs(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
     if len(instanceIDs) == 0 {
         http.Error(w, "No instance IDs provided", http.StatusBadRequest)
         return
     }
+    if !requireInstancePermission(w, r, models.ActionRestart, instanceIDs) {
+        return
+    }
+
+    // In wait-for-healthy mode each instance is tracked until its status checks pass
+    waitHealthy := r.FormValue("wait_healthy") == "true"
+
+    job, err := startRestartJob(auth.GetUserName(r), instanceIDs, waitHealthy)
+    if err != nil {
+        http.Error(w, "Failed to create job", http.StatusInternalServerError)
+        log.Printf("Error creating restart job: %v", err)
+        return
+    }
+
+    // Redirect to /status page after the restart process
+    http.Redirect(w, r, "/status?job="+job.ID, http.StatusSeeOther)
+}
+
+// startRestartJob creates a restart job and reboots each instance. In wait-for-healthy
+// mode the instances are then tracked in the background until their checks pass.
+func startRestartJob(user string, instanceIDs []string, waitHealthy bool) (*models.Job, error) {
+    description := "Restart"
+    if waitHealthy {
+        description = "Restart and wait for status checks"
+    }
+    job, err := models.NewJob(models.JobTypeRestart, user, description, instanceIDs)
+    if err != nil {
+        return nil, err
+    }
 
     for _, instanceID := range instanceIDs {
-        // Retrieve instance details such as account number and region
-        instance, err := models.GetInstanceDetails(instanceID)
-        if err != nil {
-            log.Printf("Error fetching instance details for %s: %v", instanceID, err)
-            updateStatus(instanceID, "Failed to fetch instance details")
+        update := taskUpdater(job.ID, instanceID, "")
+        ec2Client, ok := rebootInstance(job.ID, instanceID, update)
+        if !ok {
             continue
         }
 
-        // Assume the role in the target AWS account and get the AWS Config
-        assumedConfig, err := aws.AssumeRoleInAccount(restarter_role_name, instance.AWSAccountNumber)
-        if err != nil {
-            log.Printf("Error assuming role in account %s for instance %s: %v", instance.AWSAccountNumber, instanceID, err)
-            updateStatus(instanceID, "Failed to assume role in account")
-            continue
+        if waitHealthy {
+            update(phaseRebooting, false)
+            go trackInstanceHealth(ec2Client, instanceID, phaseRebooting, healthSettlePeriod, update)
+        } else {
+            update("Success", true)
         }
+    }
 
-        // Confirm the assumed role identity
-        fmt.Println("Confirming assumed role identity:")
-        if err := aws.GetCallerIdentity(assumedConfig); err != nil {
-            log.Printf("Failed to confirm assumed role identity: %v", err)
-            updateStatus(instanceID, "Failed to confirm assumed role identity")
-            continue
-        }
+    return job, nil
+}
 
-        // Create an EC2 client using the assumed role config and target region
-        ec2Client, err := aws.NewEC2Client(assumedConfig, instance.Region)
-        if err != nil {
-            log.Printf("Error creating EC2 client in region %s for instance %s: %v", instance.Region, instanceID, err)
-            updateStatus(instanceID, "Failed to create EC2 client")
-            continue
-        }
+// rebootInstance assumes the restarter role in the instance's account and reboots it.
+// Failures are recorded through update and the reboot in the job's task; the EC2 client is
+// returned for follow-up calls.
+func rebootInstance(jobID, instanceID string, update statusUpdater) (*ec2.Client, bool) {
+    // Retrieve instance details such as account number and region
+    instance, err := models.GetInstanceDetails(instanceID)
+    if err != nil {
+        log.Printf("Error fetching instance details for %s: %v", instanceID, err)
+        update("Failed to fetch instance details", true)
+        return nil, false
+    }
 
-        // Optional: List instances available to the assumed role to confirm visibility
-        err = aws.ListInstances(ec2Client)
-        if err != nil {
-            log.Printf("Failed to list instances in region %s: %v", instance.Region, err)
-        }
+    // Assume the role in the target AWS account and get the AWS Config
+    assumedConfig, err := aws.AssumeRoleInAccount(restarter_role_name, instance.AWSAccountNumber)
+    if err != nil {
+        log.Printf("Error assuming role in account %s for instance %s: %v", instance.AWSAccountNumber, instanceID, err)
+        update("Failed to assume role in account", true)
+        return nil, false
+    }
 
-        // Attempt to restart the specific instance
-        err = aws.RestartEC2Instance(ec2Client, instanceID)
-        if err != nil {
-            log.Printf("Failed to restart instance %s: %v", instanceID, err)
-            updateStatus(instanceID, "Failed to restart instance")
-        } else {
-            log.Printf("Successfully restarted instance %s in region %s", instanceID, instance.Region)
-            updateStatus(instanceID, "Success")
-        }
+    // Confirm the assumed role identity
+    fmt.Println("Confirming assumed role identity:")
+    if err := aws.GetCallerIdentity(assumedConfig); err != nil {
+        log.Printf("Failed to confirm assumed role identity: %v", err)
+        update("Failed to confirm assumed role identity", true)
+        return nil, false
     }
 
-    // Redirect to /status page after the restart process
-    http.Redirect(w, r, "/status", http.StatusSeeOther)
+    // Create an EC2 client using the assumed role config and target region
+    ec2Client, err := aws.NewEC2Client(assumedConfig, instance.Region)
+    if err != nil {
+        log.Printf("Error creating EC2 client in region %s for instance %s: %v", instance.Region, instanceID, err)
+        update("Failed to create EC2 client", true)
+        return nil, false
+    }
+
+    // Optional: List instances available to the assumed role to confirm visibility
+    err = aws.ListInstances(ec2Client)
+    if err != nil {
+        log.Printf("Failed to list instances in region %s: %v", instance.Region, err)
+    }
+
+    // Attempt to restart the specific instance
+    err = aws.RestartEC2Instance(ec2Client, instanceID)
+    if err != nil {
+        log.Printf("Failed to restart instance %s: %v", instanceID, err)
+        update("Failed to restart instance", true)
+        return nil, false
+    }
+
+    log.Printf("Successfully restarted instance %s in region %s", instanceID, instance.Region)
+    recordRestarted(jobID, instanceID)
+    return ec2Client, true
 }
 
-// updateStatus safely updates the statusMap for a specific instance ID
-func updateStatus(instanceID, status string) {
-    statusLock.Lock()
-    defer statusLock.Unlock()
-    statusMap[instanceID] = InstanceStatus{
-        Status:    status,
-        Timestamp: time.Now().Format(time.RFC3339), // ISO 8601 timestamp
+// healthTimeout returns the configured time to wait for an instance to become healthy
+func healthTimeout() time.Duration {
+    if cfg != nil && cfg.Restart.HealthTimeoutMinutes > 0 {
+        return time.Duration(cfg.Restart.HealthTimeoutMinutes) * time.Minute
     }
+    return defaultHealthTimeout
 }
 
-// GetStatusMap provides a thread-safe way to access the statusMap
-func GetStatusMap() map[string]InstanceStatus {
-    statusLock.Lock()
-    defer statusLock.Unlock()
-    // Create a copy to avoid concurrent modification issues
-    copyMap := make(map[string]InstanceStatus)
-    for k, v := range statusMap {
-        copyMap[k] = v
+// healthPhase maps the observed instance health to the phase shown on the status page
+func healthPhase(health aws.InstanceHealth, pendingPhase string) string {
+    switch {
+    case health.State != "running":
+        return fmt.Sprintf("%s (%s)", pendingPhase, health.State)
+    case health.Healthy():
+        // Checks may still report ok from before the reboot
+        return pendingPhase
+    case health.SystemStatus == "impaired" || health.InstanceStatus == "impaired":
+        return phaseChecksImpaired
+    default:
+        return phaseChecksInitializing
+    }
+}
+
+// trackInstanceHealth follows an instance until both status checks pass or the timeout expires,
+// reporting each phase through update. pendingPhase is shown until the instance is running.
+// It returns true if the instance became healthy.
+func trackInstanceHealth(ec2Client *ec2.Client, instanceID, pendingPhase string, settle time.Duration, update statusUpdater) bool {
+    _, err := aws.WaitForInstanceHealthy(ec2Client, instanceID, settle, healthTimeout(), func(health aws.InstanceHealth) {
+        update(healthPhase(health, pendingPhase), false)
+    })
+    if errors.Is(err, aws.ErrHealthTimeout) {
+        log.Printf("Instance %s not healthy after %s: %v", instanceID, pendingPhase, err)
+        update(phaseUnhealthyTimeout, true)
+        return false
+    } else if err != nil {
+        log.Printf("Error checking health of instance %s: %v", instanceID, err)
+        update("Failed to check instance health", true)
+        return false
+    }
+    update(phaseHealthy, true)
+    return true
+}
+
+// recordRestarted records that EC2 accepted the reboot or start of an instance, from when the
+// inventory counts its uptime
+func recordRestarted(jobID, instanceID string) {
+    restartedAt := time.Now()
+    err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+        task.RestartedAt = &restartedAt
+    })
+    if err != nil {
+        log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
+    }
+}
+
+// taskUpdater returns a statusUpdater that records statuses in the job's task for an instance
+func taskUpdater(jobID, instanceID, warning string) statusUpdater {
+    return func(status string, done bool) {
+        err := models.UpdateTask(jobID, instanceID, func(task *models.Task) {
+            task.Status = status
+            task.Done = done
+            task.Warning = warning
+        })
+        if err != nil {
+            log.Printf("Error updating task for instance %s in job %s: %v", instanceID, jobID, err)
+        }
     }
-    return copyMap
 }
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+    "log"
+    "sync"
+    "time"
+
+    "ec2-restart-manager/models"
+)
+
+// startRollout stores a new rollout with its job and runs it in the background, returning
+// the ID of the job
+func startRollout(instanceIDs []string, settings models.RolloutSettings, user string) (string, error) {
+    job, err := models.NewRolloutJob(user, instanceIDs, settings)
+    if err != nil {
+        return "", err
+    }
+
+    go runRollout(job.ID)
+    return job.ID, nil
+}
+
+// runRollout restarts each batch in turn, waiting for it to become healthy, and aborts
+// the remaining batches once more than MaxFailures instances have failed
+func runRollout(id string) {
+    setRolloutState(id, models.RolloutRunning)
+
+    rollout, err := models.GetRollout(id)
+    if err != nil {
+        log.Printf("Error retrieving rollout %s: %v", id, err)
+        return
+    }
+    for i := range rollout.Batches {
+        updateBatch(id, i, func(batch *models.RolloutBatch) {
+            batch.State = models.RolloutRunning
+            batch.StartedAt = time.Now().Format(time.RFC3339)
+        })
+
+        failures := restartBatch(rollout.JobID, rollout.Batches[i].InstanceIDs)
+
+        aborted := false
+        totalFailures := 0
+        updateRollout(id, func(r *models.Rollout) {
+            aborted = r.FinishBatch(i, failures)
+            totalFailures = r.Failures
+        })
+        if aborted {
+            // Close the tasks of the skipped batches so that the job completes
+            for _, batch := range rollout.Batches[i+1:] {
+                for _, instanceID := range batch.InstanceIDs {
+                    taskUpdater(rollout.JobID, instanceID, "")(models.RolloutSkipped, true)
+                }
+            }
+            log.Printf("Rollout %s aborted after batch %d with %d failed instances", id, i+1, totalFailures)
+            return
+        }
+
+        // Give the service time to settle before taking down the next batch
+        if i < len(rollout.Batches)-1 && rollout.Settings.Pause > 0 {
+            setRolloutState(id, models.RolloutPausing)
+            time.Sleep(rollout.Settings.Pause)
+            setRolloutState(id, models.RolloutRunning)
+        }
+    }
+
+    updateRollout(id, func(r *models.Rollout) {
+        r.State = models.RolloutSucceeded
+        if r.Failures > 0 {
+            r.State = models.RolloutFailed
+        }
+    })
+    log.Printf("Rollout %s finished", id)
+}
+
+// restartBatch reboots all instances of a batch concurrently and waits until each one
+// is healthy or has failed, returning the number of failed instances
+func restartBatch(jobID string, instanceIDs []string) int {
+    var wg sync.WaitGroup
+    var failuresLock sync.Mutex
+    failures := 0
+
+    for _, instanceID := range instanceIDs {
+        wg.Add(1)
+        go func(instanceID string) {
+            defer wg.Done()
+
+            update := taskUpdater(jobID, instanceID, "")
+            healthy := false
+            if ec2Client, ok := rebootInstance(jobID, instanceID, update); ok {
+                update(phaseRebooting, false)
+                healthy = trackInstanceHealth(ec2Client, instanceID, phaseRebooting, healthSettlePeriod, update)
+            }
+            if !healthy {
+                failuresLock.Lock()
+                failures++
+                failuresLock.Unlock()
+            }
+        }(instanceID)
+    }
+
+    wg.Wait()
+    return failures
+}
+
+// updateRollout applies a change to a rollout in the job store
+func updateRollout(id string, change func(*models.Rollout)) {
+    if err := models.UpdateRollout(id, change); err != nil {
+        log.Printf("Error updating rollout %s: %v", id, err)
+    }
+}
+
+// updateBatch applies a change to one batch of a rollout
+func updateBatch(id string, index int, change func(*models.RolloutBatch)) {
+    updateRollout(id, func(r *models.Rollout) {
+        change(&r.Batches[index])
+    })
+}
+
+// setRolloutState sets the overall state of a rollout
+func setRolloutState(id, state string) {
+    updateRollout(id, func(r *models.Rollout) {
+        r.State = state
+    })
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+    "fmt"
+    "html/template"
+    "log"
+    "net/http"
+    "strconv"
+    "time"
+
+    "ec2-restart-manager/auth"
+    "ec2-restart-manager/config"
+    "ec2-restart-manager/models"
+)
+
+// RolloutHandler starts a rolling restart of the selected instances
+func RolloutHandler(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+        log.Printf("Error parsing form data: %v", err)
+        return
+    }
+
+    instanceIDs, err := selectedInstanceIDs(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if len(instanceIDs) == 0 {
+        http.Error(w, "No instance IDs provided", http.StatusBadRequest)
+        return
+    }
+    if !requireInstancePermission(w, r, models.ActionRestart, instanceIDs) {
+        return
+    }
+
+    settings, err := parseRolloutSettings(r)
+    if err != nil {
+        http.Error(w, "Invalid rollout settings: "+err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    id, err := startRollout(instanceIDs, settings, auth.GetUserName(r))
+    if err != nil {
+        http.Error(w, "Failed to start rollout", http.StatusInternalServerError)
+        log.Printf("Error starting rollout: %v", err)
+        return
+    }
+    log.Printf("Started rollout %s over %d instances", id, len(instanceIDs))
+
+    http.Redirect(w, r, "/rollouts?id="+id, http.StatusSeeOther)
+}
+
+// parseRolloutSettings reads the rollout settings from the submitted form
+func parseRolloutSettings(r *http.Request) (models.RolloutSettings, error) {
+    var settings models.RolloutSettings
+    var err error
+
+    if settings.BatchSize, err = formInt(r, "batch_size", 1); err != nil {
+        return settings, err
+    }
+    if settings.BatchPercent, err = formInt(r, "batch_percent", 0); err != nil {
+        return settings, err
+    }
+    if settings.MaxFailures, err = formInt(r, "max_failures", 0); err != nil {
+        return settings, err
+    }
+    pauseSeconds, err := formInt(r, "pause_seconds", 0)
+    if err != nil {
+        return settings, err
+    }
+    settings.Pause = time.Duration(pauseSeconds) * time.Second
+
+    return settings, nil
+}
+
+// formInt parses a non-negative integer form value, falling back to def when it is empty
+func formInt(r *http.Request, name string, def int) (int, error) {
+    value := r.FormValue(name)
+    if value == "" {
+        return def, nil
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("%s must be a non-negative number, got %q", name, value)
+    }
+    return n, nil
+}
+
+// RolloutStatusHandler renders the progress of a single rollout, or the list of all rollouts,
+// showing only the instances the caller may see
+func RolloutStatusHandler(w http.ResponseWriter, r *http.Request) {
+    isLoggedIn := auth.IsUserLoggedIn(r)
+
+    data := models.TemplateData{
+        Title:      "Rolling Restarts",
+        IsLoggedIn: isLoggedIn,
+        Version:    config.Version,
+        StatusMap:  make(map[string]string),
+        Data:       map[string]interface{}{},
+    }
+
+    if id := r.URL.Query().Get("id"); id != "" {
+        job, err := models.GetJob(id)
+        if err != nil {
+            http.Error(w, "Rollout not found", http.StatusNotFound)
+            return
+        }
+        rollout, readable := readableRollout(r, job)
+        if !readable {
+            http.Error(w, "Rollout not found", http.StatusNotFound)
+            return
+        }
+        data.Data["Rollout"] = rollout
+
+        // Current phase of every instance in the rollout
+        for _, task := range readableJob(r, job).Tasks {
+            data.StatusMap[task.InstanceID] = task.Status
+        }
+    } else {
+        jobs, err := models.ListJobs(models.JobTypeRollout)
+        if err != nil {
+            http.Error(w, "Failed to load rollouts", http.StatusInternalServerError)
+            log.Printf("Error loading rollout jobs: %v", err)
+            return
+        }
+        var list []models.Rollout
+        for _, job := range jobs {
+            if rollout, readable := readableRollout(r, job); readable {
+                list = append(list, rollout)
+            }
+        }
+        data.Data["Rollouts"] = list
+    }
+
+    tmpl, err := template.ParseFiles("templates/rollouts.html", "templates/layout.html")
+    if err != nil {
+        http.Error(w, "Failed to load template", http.StatusInternalServerError)
+        log.Printf("Error loading templates: %v\n", err)
+        return
+    }
+
+    if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+        log.Printf("Error rendering rollouts page: %v\n", err)
+        http.Error(w, "Error rendering rollouts page", http.StatusInternalServerError)
+    }
+}
+
+// readableRollout returns the rollout of a job with its batches reduced to the instances the
+// caller may see, and whether it is a rollout with any such instance
+func readableRollout(r *http.Request, job *models.Job) (models.Rollout, bool) {
+    readable := readableJob(r, job)
+    if readable.Rollout == nil || len(readable.Tasks) == 0 {
+        return models.Rollout{}, false
+    }
+    rollout := *readable.Rollout
+    rollout.JobID = job.ID
+    return rollout, true
+}
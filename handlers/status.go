@@ -10,38 +10,34 @@ import (
     "ec2-restart-manager/config"
 )
 
-// StatusHandler renders the status page, showing the status of each instance restart
+// restartJobTypes are the job types shown on the restart status page
+var restartJobTypes = []string{models.JobTypeRestart, models.JobTypeStopStart, models.JobTypeRollout}
+
+// StatusHandler renders the status page, showing the history of restart jobs
+// or a single job when the job query parameter is set
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
     isLoggedIn := auth.IsUserLoggedIn(r)
 
-    // Safely retrieve a copy of the statusMap
-    currentStatusMap := GetStatusMap()
-
-    // Map instance statuses to EC2Instance objects for rendering
-    var instancesWithStatus []models.EC2Instance
-    for id, instanceStatus := range currentStatusMap {
-        instance, err := models.GetInstanceDetails(id)
-        if err != nil {
-            log.Printf("Error retrieving instance details for ID %s: %v", id, err)
-            continue
-        }
-
-        // Add status and timestamp to the instance details
-        instance.State = instanceStatus.Status               // Assign the status
-        instance.RestartTimestamp = instanceStatus.Timestamp // Assign the timestamp
-        instancesWithStatus = append(instancesWithStatus, *instance)
+    jobs, err := loadJobs(r, restartJobTypes...)
+    if err != nil {
+        http.Error(w, "Failed to load jobs", http.StatusInternalServerError)
+        log.Printf("Error loading restart jobs: %v", err)
+        return
     }
 
     // Prepare template data
     data := models.TemplateData{
         Title:     "Instance Restart Status",
         IsLoggedIn: isLoggedIn,
-        Instances: instancesWithStatus, // Use the Instances field to pass instance data
         Version:  config.Version,
+        Data: map[string]interface{}{
+            "Jobs":  jobs,
+            "JobID": r.URL.Query().Get("job"),
+        },
     }
 
     // Load and parse the templates
-    tmpl, err := template.ParseFiles("templates/status.html", "templates/layout.html")
+    tmpl, err := template.ParseFiles("templates/status.html", "templates/task_events.html", "templates/layout.html")
     if err != nil {
         http.Error(w, "Failed to load template", http.StatusInternalServerError)
         log.Printf("Error loading templates: %v\n", err)
@@ -54,3 +50,20 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "Error rendering status page", http.StatusInternalServerError)
     }
 }
+
+// loadJobs returns the job named by the job query parameter, or the history of jobs of the given
+// types, reduced to the tasks the caller may see
+func loadJobs(r *http.Request, types ...string) ([]*models.Job, error) {
+    if id := r.URL.Query().Get("job"); id != "" {
+        job, err := models.GetJob(id)
+        if err != nil {
+            return nil, err
+        }
+        return readableJobs(r, []*models.Job{job}), nil
+    }
+    jobs, err := models.ListJobs(types...)
+    if err != nil {
+        return nil, err
+    }
+    return readableJobs(r, jobs), nil
+}
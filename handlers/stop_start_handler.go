@@ -0,0 +1,142 @@
+package handlers
+
+import (
+    "log"
+    "net/http"
+
+    "ec2-restart-manager/auth"
+    "ec2-restart-manager/aws"
+    "ec2-restart-manager/models"
+    "github.com/aws/aws-sdk-go-v2/service/ec2"
+    "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Phases reported on the status page during a stop/start cycle
+const (
+    phaseStopping = "Stopping"
+    phaseStarting = "Starting"
+)
+
+// StopStartHandler handles the request to stop and start EC2 instances so that they
+// move to new hardware, e.g. for scheduled-retirement events or degraded hosts
+func StopStartHandler(w http.ResponseWriter, r *http.Request) {
+    if err := r.ParseForm(); err != nil {
+        http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+        log.Printf("Error parsing form data: %v", err)
+        return
+    }
+
+    instanceIDs, err := selectedInstanceIDs(r)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    if len(instanceIDs) == 0 {
+        http.Error(w, "No instance IDs provided", http.StatusBadRequest)
+        return
+    }
+    if !requireInstancePermission(w, r, models.ActionRestart, instanceIDs) {
+        return
+    }
+
+    job, err := models.NewJob(models.JobTypeStopStart, auth.GetUserName(r), "Stop and start", instanceIDs)
+    if err != nil {
+        http.Error(w, "Failed to create job", http.StatusInternalServerError)
+        log.Printf("Error creating stop/start job: %v", err)
+        return
+    }
+
+    for _, instanceID := range instanceIDs {
+        update := taskUpdater(job.ID, instanceID, "")
+
+        // Retrieve instance details such as account number and region
+        instance, err := models.GetInstanceDetails(instanceID)
+        if err != nil {
+            log.Printf("Error fetching instance details for %s: %v", instanceID, err)
+            update("Failed to fetch instance details", true)
+            continue
+        }
+
+        // Assume the role in the target AWS account and get the AWS Config
+        assumedConfig, err := aws.AssumeRoleInAccount(restarter_role_name, instance.AWSAccountNumber)
+        if err != nil {
+            log.Printf("Error assuming role in account %s for instance %s: %v", instance.AWSAccountNumber, instanceID, err)
+            update("Failed to assume role in account", true)
+            continue
+        }
+
+        // Create an EC2 client using the assumed role config and target region
+        ec2Client, err := aws.NewEC2Client(assumedConfig, instance.Region)
+        if err != nil {
+            log.Printf("Error creating EC2 client in region %s for instance %s: %v", instance.Region, instanceID, err)
+            update("Failed to create EC2 client", true)
+            continue
+        }
+
+        description, err := aws.DescribeEC2Instance(ec2Client, instanceID)
+        if err != nil {
+            log.Printf("Failed to describe instance %s: %v", instanceID, err)
+            update("Failed to describe instance", true)
+            continue
+        }
+
+        // Instance-store volumes are lost on stop, so these instances can only be rebooted
+        if description.RootDeviceType == types.DeviceTypeInstanceStore {
+            log.Printf("Refusing to stop instance-store-backed instance %s", instanceID)
+            update("Refused: instance-store-backed instance cannot be stopped", true)
+            continue
+        }
+
+        warning, err := publicIPWarning(ec2Client, description)
+        if err != nil {
+            log.Printf("Failed to check Elastic IP for instance %s: %v", instanceID, err)
+            update("Failed to check Elastic IP", true)
+            continue
+        }
+
+        update = taskUpdater(job.ID, instanceID, warning)
+        update(phaseStopping, false)
+        go stopStartInstance(ec2Client, job.ID, instanceID, update)
+    }
+
+    // Redirect to /status page where the stop/start cycle can be followed
+    http.Redirect(w, r, "/status?job="+job.ID, http.StatusSeeOther)
+}
+
+// publicIPWarning returns a warning when the instance has a public IP that is not an Elastic IP,
+// since that address is released on stop and a new one is assigned on start
+func publicIPWarning(ec2Client *ec2.Client, description types.Instance) (string, error) {
+    if description.PublicIpAddress == nil {
+        return "", nil
+    }
+
+    hasElasticIP, err := aws.HasElasticIP(ec2Client, *description.InstanceId)
+    if err != nil {
+        return "", err
+    }
+    if hasElasticIP {
+        return "", nil
+    }
+    return "No Elastic IP: public IP " + *description.PublicIpAddress + " will change", nil
+}
+
+// stopStartInstance stops an instance, waits for it to be stopped, starts it again and
+// follows it until its status checks pass
+func stopStartInstance(ec2Client *ec2.Client, jobID, instanceID string, update statusUpdater) {
+    if err := aws.StopEC2Instance(ec2Client, instanceID, healthTimeout()); err != nil {
+        log.Printf("Failed to stop instance %s: %v", instanceID, err)
+        update("Failed to stop instance", true)
+        return
+    }
+
+    update(phaseStarting, false)
+    if err := aws.StartEC2Instance(ec2Client, instanceID); err != nil {
+        log.Printf("Failed to start instance %s: %v", instanceID, err)
+        update("Failed to start instance", true)
+        return
+    }
+    recordRestarted(jobID, instanceID)
+
+    // Status checks start from scratch after a start, so no settle period is needed
+    trackInstanceHealth(ec2Client, instanceID, phaseStarting, 0, update)
+}
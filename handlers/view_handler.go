@@ -0,0 +1,117 @@
+// handlers/view_handler.go
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"ec2-restart-manager/auth"
+	"ec2-restart-manager/models"
+	"ec2-restart-manager/utils"
+)
+
+// viewOption is a saved view offered on the index page
+type viewOption struct {
+	*models.SavedView
+	URL       string // Index page showing the view's instances
+	Active    bool   // The current filters are the view's
+	CanDelete bool
+}
+
+// SaveViewHandler saves the filters of the index page as a named view
+func SaveViewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := normalizeViewFilter(r.FormValue("filter"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	view, err := models.CreateView(r.FormValue("name"), r.FormValue("scope"), filter, auth.GetUserID(r), auth.GetUserName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("View %q (%s) saved by %s with scope %s", view.Name, view.ID, view.Owner, view.Scope)
+
+	http.Redirect(w, r, "/?"+view.Filter, http.StatusSeeOther)
+}
+
+// DeleteViewHandler deletes a saved view
+func DeleteViewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.FormValue("id")
+	if err := models.DeleteView(id, auth.GetUserID(r), auth.IsAdmin(r)); err != nil {
+		http.Error(w, "Failed to delete view", http.StatusForbidden)
+		log.Printf("Error deleting view %s: %v", id, err)
+		return
+	}
+	log.Printf("View %s deleted by %s", id, auth.GetUserName(r))
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// savedViewOptions lists the views the caller sees, marking the one matching filter
+func savedViewOptions(r *http.Request, filter utils.InstanceFilter) []viewOption {
+	userID := auth.GetUserID(r)
+	if userID == "" {
+		return nil
+	}
+	views, err := models.ListViews(userID)
+	if err != nil {
+		log.Printf("Error loading saved views: %v", err)
+		return nil
+	}
+
+	current := filter.Query().Encode()
+	var options []viewOption
+	for _, view := range views {
+		options = append(options, viewOption{
+			SavedView: view,
+			URL:       "/?" + view.Filter,
+			Active:    view.Filter == current,
+			CanDelete: view.OwnedBy(userID) || auth.IsAdmin(r),
+		})
+	}
+	return options
+}
+
+// viewFilter parses the filter of a saved view
+func viewFilter(view *models.SavedView) (utils.InstanceFilter, error) {
+	query, err := url.ParseQuery(view.Filter)
+	if err != nil {
+		return utils.InstanceFilter{}, fmt.Errorf("view %q has an invalid filter: %w", view.Name, err)
+	}
+	filter, err := utils.ParseInstanceFilter(query)
+	if err != nil {
+		return utils.InstanceFilter{}, fmt.Errorf("view %q has an invalid filter: %w", view.Name, err)
+	}
+	return filter, nil
+}
+
+// normalizeViewFilter checks encoded filter parameters and returns them in the canonical
+// form used to recognise the active view
+func normalizeViewFilter(encoded string) (string, error) {
+	query, err := url.ParseQuery(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid filter parameters: %w", err)
+	}
+	filter, err := utils.ParseInstanceFilter(query)
+	if err != nil {
+		return "", err
+	}
+	return filter.Query().Encode(), nil
+}
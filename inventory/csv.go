@@ -0,0 +1,48 @@
+// inventory/csv.go
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// CSVDecoder decodes a CSV export with a header row naming the columns
+type CSVDecoder struct {
+	mapping ColumnMapping
+}
+
+// Decode parses the CSV rows into instances
+func (d CSVDecoder) Decode(content []byte) ([]models.EC2Instance, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for index, column := range header {
+		header[index] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	}
+
+	collector := rowCollector{mapping: d.mapping}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]string, len(header))
+		for index, value := range record {
+			values[header[index]] = value
+		}
+		if err := collector.add(line, values); err != nil {
+			return nil, err
+		}
+	}
+	return collector.result(), nil
+}
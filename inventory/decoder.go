@@ -0,0 +1,156 @@
+// inventory/decoder.go
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// Decoder turns the content of an inventory export into instances
+type Decoder interface {
+	Decode(content []byte) ([]models.EC2Instance, error)
+}
+
+// Inventory export formats
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// formatExtensions maps object key extensions to the format they are decoded with
+var formatExtensions = map[string]string{
+	".csv":     FormatCSV,
+	".jsonl":   FormatJSONL,
+	".ndjson":  FormatJSONL,
+	".parquet": FormatParquet,
+}
+
+// NewDecoder creates the decoder for the given format, or for the extension of key if no
+// format is given. Keys without a known extension are read as CSV.
+func NewDecoder(format, key string, mapping ColumnMapping) (Decoder, error) {
+	if format == "" {
+		format = formatExtensions[strings.ToLower(path.Ext(key))]
+	}
+	switch format {
+	case "", FormatCSV:
+		return CSVDecoder{mapping: mapping}, nil
+	case FormatJSONL:
+		return JSONLDecoder{mapping: mapping}, nil
+	case FormatParquet:
+		return ParquetDecoder{mapping: mapping}, nil
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q", format)
+	}
+}
+
+// DefaultColumns maps instance fields to the columns of the inventory export
+var DefaultColumns = map[string]string{
+	"aws_account_name":   "AWS Account Name",
+	"aws_account_number": "AWS Account ID",
+	"state":              "State",
+	"uptime_days":        "Uptime Days",
+	"name":               "EC2 Name",
+	"service":            "Service",
+	"owner":              "Owner",
+	"id":                 "ID",
+	"region":             "Region",
+	"environment_class":  "EnvironmentClass",
+}
+
+// DefaultStates are the instance states kept from the inventory export
+var DefaultStates = []string{"running"}
+
+// ColumnMapping describes how the rows of an inventory export become instances. It is
+// shared by all formats so that they filter and map rows the same way.
+type ColumnMapping struct {
+	Columns map[string]string // Instance field to column name
+	States  []string          // States of the rows to keep; empty keeps every row
+
+	fields map[string]string // Column name to instance field
+}
+
+// NewColumnMapping overrides the default columns and states with the configured ones
+func NewColumnMapping(columns map[string]string, states []string) (ColumnMapping, error) {
+	mapping := ColumnMapping{Columns: make(map[string]string), States: DefaultStates}
+	for field, column := range DefaultColumns {
+		mapping.Columns[field] = column
+	}
+	for field, column := range columns {
+		if !containsString(models.InstanceFields, field) {
+			return ColumnMapping{}, fmt.Errorf("unknown instance field %q in inventory columns", field)
+		}
+		mapping.Columns[field] = column
+	}
+	if states != nil {
+		mapping.States = states
+	}
+
+	mapping.fields = make(map[string]string)
+	for field, column := range mapping.Columns {
+		mapping.fields[column] = field
+	}
+	return mapping, nil
+}
+
+// rowCollector builds instances from the rows of an export. Mapped columns fill the
+// instance fields and every other non-empty column is kept in the instance tags. Rows in
+// states other than the mapping's are skipped.
+type rowCollector struct {
+	mapping   ColumnMapping
+	instances []models.EC2Instance
+	skipped   int
+}
+
+// add adds the instance of a row of column values, in which row is a line or row number
+// for errors
+func (c *rowCollector) add(row int, values map[string]string) error {
+	if _, exists := values[c.mapping.Columns["id"]]; !exists {
+		return fmt.Errorf("row %d has no %q column for the instance ID", row, c.mapping.Columns["id"])
+	}
+	if _, exists := values[c.mapping.Columns["state"]]; !exists && len(c.mapping.States) > 0 {
+		return fmt.Errorf("row %d has no %q column for the instance state", row, c.mapping.Columns["state"])
+	}
+
+	var instance models.EC2Instance
+	for column, value := range values {
+		column = strings.TrimSpace(column)
+		if field, mapped := c.mapping.fields[column]; mapped {
+			instance.SetField(field, value)
+		} else if value != "" {
+			if instance.Tags == nil {
+				instance.Tags = make(map[string]string)
+			}
+			instance.Tags[column] = value
+		}
+	}
+
+	if len(c.mapping.States) > 0 && !containsString(c.mapping.States, instance.State) {
+		c.skipped++
+		return nil
+	}
+	c.instances = append(c.instances, instance)
+	return nil
+}
+
+// result returns the collected instances
+func (c *rowCollector) result() []models.EC2Instance {
+	if c.skipped > 0 {
+		log.Printf("Skipped %d inventory rows in states other than %s", c.skipped, strings.Join(c.mapping.States, ", "))
+	}
+	return c.instances
+}
+
+// containsString checks if slice contains item
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ec2-restart-manager/models"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// decoderTestColumns are the columns of the test export. Application is mapped to the service
+// by the configuration, so the default Service column becomes a tag.
+var decoderTestColumns = []string{"ID", "EC2 Name", "State", "Uptime Days", "Application", "Service", "Patch Group", "Empty Column"}
+
+// decoderTestRows are the rows of the test export; nil is a null value where the format has them
+var decoderTestRows = [][]*string{
+	{text("i-1"), text("web-1"), text("running"), text("12"), text("checkout"), text("legacy"), text("group-a"), text("")},
+	{text("i-2"), text("web-2"), text("stopped"), text("3"), text("checkout"), text(""), text("group-b"), text("")},
+	{text("i-3"), text("db-1"), text("running"), nil, text("search"), nil, nil, nil},
+}
+
+func text(value string) *string {
+	return &value
+}
+
+func csvExport(t *testing.T) []byte {
+	var content bytes.Buffer
+	writer := csv.NewWriter(&content)
+	writer.Write(decoderTestColumns)
+	for _, row := range decoderTestRows {
+		record := make([]string, len(row))
+		for index, value := range row {
+			if value != nil {
+				record[index] = *value
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return content.Bytes()
+}
+
+func jsonlExport(t *testing.T) []byte {
+	var content bytes.Buffer
+	for _, row := range decoderTestRows {
+		object := make(map[string]interface{})
+		for index, value := range row {
+			switch {
+			case value == nil:
+				object[decoderTestColumns[index]] = nil
+			case decoderTestColumns[index] == "Uptime Days":
+				object[decoderTestColumns[index]] = json.Number(*value)
+			default:
+				object[decoderTestColumns[index]] = *value
+			}
+		}
+		line, err := json.Marshal(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content.Write(append(line, '\n'))
+	}
+	return content.Bytes()
+}
+
+func parquetExport(t *testing.T) []byte {
+	var metadata []string
+	for _, column := range decoderTestColumns {
+		if column == "Uptime Days" {
+			metadata = append(metadata, "name="+column+", type=INT32, repetitiontype=OPTIONAL")
+		} else {
+			metadata = append(metadata, "name="+column+", type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL")
+		}
+	}
+
+	var content bytes.Buffer
+	parquetWriter, err := writer.NewCSVWriterFromWriter(metadata, &content, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range decoderTestRows {
+		if err := parquetWriter.WriteString(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := parquetWriter.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bytes()
+}
+
+func TestDecoders(t *testing.T) {
+	exports := map[string]func(*testing.T) []byte{
+		FormatCSV:     csvExport,
+		FormatJSONL:   jsonlExport,
+		FormatParquet: parquetExport,
+	}
+
+	web1 := models.EC2Instance{
+		ID: "i-1", EC2Name: "web-1", State: "running", UptimeDays: "12", Service: "checkout",
+		Tags: map[string]string{"Service": "legacy", "Patch Group": "group-a"},
+	}
+	web2 := models.EC2Instance{
+		ID: "i-2", EC2Name: "web-2", State: "stopped", UptimeDays: "3", Service: "checkout",
+		Tags: map[string]string{"Patch Group": "group-b"},
+	}
+	db1 := models.EC2Instance{ID: "i-3", EC2Name: "db-1", State: "running", Service: "search"}
+
+	tests := []struct {
+		name   string
+		states []string
+		want   []models.EC2Instance
+	}{
+		{"default states", nil, []models.EC2Instance{web1, db1}},
+		{"configured states", []string{"stopped"}, []models.EC2Instance{web2}},
+		{"every state", []string{}, []models.EC2Instance{web1, web2, db1}},
+	}
+	for format, export := range exports {
+		content := export(t)
+		for _, test := range tests {
+			t.Run(format+"/"+test.name, func(t *testing.T) {
+				mapping, err := NewColumnMapping(map[string]string{"service": "Application"}, test.states)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoder, err := NewDecoder(format, "", mapping)
+				if err != nil {
+					t.Fatal(err)
+				}
+				instances, err := decoder.Decode(content)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(instances, test.want) {
+					t.Errorf("decoded %+v\nwant %+v", instances, test.want)
+				}
+			})
+		}
+	}
+}
+
+func TestDecoderRequiredColumns(t *testing.T) {
+	mapping, err := NewColumnMapping(map[string]string{"id": "Instance"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = CSVDecoder{mapping: mapping}.Decode(csvExport(t))
+	if err == nil || !strings.Contains(err.Error(), `no "Instance" column`) {
+		t.Errorf("got %v, want an error for the missing ID column", err)
+	}
+
+	if _, err := NewColumnMapping(map[string]string{"platform": "Platform"}, nil); err == nil {
+		t.Error("mapping accepted an unknown instance field")
+	}
+}
+
+func TestNewDecoderFormat(t *testing.T) {
+	tests := []struct {
+		format, key string
+		want        Decoder
+	}{
+		{"", "export.csv", CSVDecoder{}},
+		{"", "export.JSONL", JSONLDecoder{}},
+		{"", "export.ndjson", JSONLDecoder{}},
+		{"", "export.parquet", ParquetDecoder{}},
+		{"", "export", CSVDecoder{}},
+		{FormatJSONL, "export.csv", JSONLDecoder{}},
+	}
+	for _, test := range tests {
+		decoder, err := NewDecoder(test.format, test.key, ColumnMapping{})
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.format, test.key, err)
+		}
+		if reflect.TypeOf(decoder) != reflect.TypeOf(test.want) {
+			t.Errorf("%q %q decoded as %T, want %T", test.format, test.key, decoder, test.want)
+		}
+	}
+	if _, err := NewDecoder("xml", "export.xml", ColumnMapping{}); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
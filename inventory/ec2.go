@@ -0,0 +1,204 @@
+// inventory/ec2.go
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ec2-restart-manager/aws"
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Defaults for the ec2 inventory source
+const (
+	defaultReadRoleName    = "ec2-restart-manager-restarter"
+	defaultScanConcurrency = 10
+)
+
+// defaultTagKeys maps instance fields to the tags they are read from
+var defaultTagKeys = map[string]string{
+	"name":              "Name",
+	"service":           "Service",
+	"owner":             "Owner",
+	"environment_class": "EnvironmentClass",
+}
+
+// EC2Provider discovers running instances live by assuming a role in each configured
+// account and describing the instances in each configured region
+type EC2Provider struct {
+	roleName    string
+	accounts    []config.EC2AccountConfig
+	regions     []string
+	concurrency int
+	tagKeys     map[string]string
+	lastScan    map[string][]models.EC2Instance // Instances of each account/region pair at its last successful scan
+}
+
+// NewEC2Provider creates a provider scanning the configured accounts and regions
+func NewEC2Provider(cfg config.EC2InventoryConfig) (*EC2Provider, error) {
+	if len(cfg.Accounts) == 0 || len(cfg.Regions) == 0 {
+		return nil, fmt.Errorf("the ec2 inventory source needs at least one account and region")
+	}
+
+	tagKeys := make(map[string]string)
+	for field, key := range defaultTagKeys {
+		tagKeys[field] = key
+	}
+	for field, key := range cfg.Tags {
+		if _, known := defaultTagKeys[field]; !known {
+			return nil, fmt.Errorf("unknown instance field %q in inventory tags", field)
+		}
+		tagKeys[field] = key
+	}
+
+	provider := &EC2Provider{
+		roleName:    cfg.RoleName,
+		accounts:    cfg.Accounts,
+		regions:     cfg.Regions,
+		concurrency: cfg.Concurrency,
+		tagKeys:     tagKeys,
+		lastScan:    make(map[string][]models.EC2Instance),
+	}
+	if provider.roleName == "" {
+		provider.roleName = defaultReadRoleName
+	}
+	if provider.concurrency <= 0 {
+		provider.concurrency = defaultScanConcurrency
+	}
+	return provider, nil
+}
+
+// Name describes the source
+func (p *EC2Provider) Name() string {
+	return fmt.Sprintf("ec2 (%d accounts, %d regions)", len(p.accounts), len(p.regions))
+}
+
+// Version of a live scan, which always reflects the current state
+func (p *EC2Provider) Version() string {
+	return "live"
+}
+
+// Instances scans all account/region pairs concurrently. Pairs that fail are logged and
+// keep the instances of their last successful scan, so that a transient error does not
+// remove them from the inventory; an error is only returned when every pair failed.
+func (p *EC2Provider) Instances() ([]models.EC2Instance, error) {
+	var (
+		mutex     sync.Mutex
+		wg        sync.WaitGroup
+		instances []models.EC2Instance
+		errs      []string
+	)
+	semaphore := make(chan struct{}, p.concurrency)
+
+	for _, account := range p.accounts {
+		for _, region := range p.regions {
+			wg.Add(1)
+			go func(account config.EC2AccountConfig, region string) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				found, err := p.scan(account, region)
+
+				pair := account.ID + "/" + region
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err != nil {
+					log.Printf("Error scanning instances in account %s region %s: %v", account.ID, region, err)
+					errs = append(errs, fmt.Sprintf("%s: %v", pair, err))
+					found = p.lastScan[pair]
+				} else {
+					p.lastScan[pair] = found
+				}
+				instances = append(instances, found...)
+			}(account, region)
+		}
+	}
+	wg.Wait()
+
+	if len(errs) == len(p.accounts)*len(p.regions) {
+		return nil, fmt.Errorf("failed to scan any account and region: %s", strings.Join(errs, "; "))
+	}
+	return instances, nil
+}
+
+// scan describes the running instances of one account and region
+func (p *EC2Provider) scan(account config.EC2AccountConfig, region string) ([]models.EC2Instance, error) {
+	assumedConfig, err := aws.AssumeRoleInAccount(p.roleName, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	ec2Client, err := aws.NewEC2Client(assumedConfig, region)
+	if err != nil {
+		return nil, err
+	}
+
+	described, err := aws.DescribeRunningInstances(ec2Client)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]models.EC2Instance, 0, len(described))
+	for _, instance := range described {
+		instances = append(instances, p.toEC2Instance(instance, account, region))
+	}
+	return instances, nil
+}
+
+// toEC2Instance maps a described instance and its tags to the inventory model
+func (p *EC2Provider) toEC2Instance(instance types.Instance, account config.EC2AccountConfig, region string) models.EC2Instance {
+	tags := make(map[string]string)
+	for _, tag := range instance.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			tags[*tag.Key] = *tag.Value
+		}
+	}
+
+	result := models.EC2Instance{
+		AWSAccountName:   account.Name,
+		AWSAccountNumber: account.ID,
+		EC2Name:          tags[p.tagKeys["name"]],
+		Service:          tags[p.tagKeys["service"]],
+		Owner:            tags[p.tagKeys["owner"]],
+		EnvironmentClass: tags[p.tagKeys["environment_class"]],
+		Region:           region,
+	}
+	if instance.InstanceId != nil {
+		result.ID = *instance.InstanceId
+	}
+
+	// Every other tag, and the instance attributes commonly filtered on, go to the instance tags
+	mapped := make(map[string]bool)
+	for _, key := range p.tagKeys {
+		mapped[key] = true
+	}
+	result.Tags = make(map[string]string)
+	for key, value := range tags {
+		if !mapped[key] && !strings.HasPrefix(key, "aws:") {
+			result.Tags[key] = value
+		}
+	}
+	result.Tags["Instance Type"] = string(instance.InstanceType)
+	if instance.ImageId != nil {
+		result.Tags["AMI"] = *instance.ImageId
+	}
+	if instance.PlatformDetails != nil {
+		result.Tags["Platform"] = *instance.PlatformDetails
+	}
+	if instance.State != nil {
+		result.State = string(instance.State.Name)
+	}
+	// Days since launch; a stop/start resets the launch time but a reboot does not, so the
+	// inventory store lowers it to the days since the last restart through a job
+	if instance.LaunchTime != nil {
+		result.UptimeDays = strconv.Itoa(int(time.Since(*instance.LaunchTime).Hours() / 24))
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+// inventory/jsonl.go
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"ec2-restart-manager/models"
+)
+
+// Longest line of a JSONL export
+const maxJSONLLineSize = 10 * 1024 * 1024
+
+// JSONLDecoder decodes newline-delimited JSON with one object per instance, keyed by
+// column name
+type JSONLDecoder struct {
+	mapping ColumnMapping
+}
+
+// Decode parses the JSON lines into instances. Strings are used as they are, other
+// values as their JSON text, and null values are left out.
+func (d JSONLDecoder) Decode(content []byte) ([]models.EC2Instance, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLineSize)
+
+	collector := rowCollector{mapping: d.mapping}
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON on line %d: %w", line, err)
+		}
+
+		values := make(map[string]string, len(object))
+		for column, raw := range object {
+			var text string
+			switch {
+			case string(raw) == "null":
+				continue
+			case json.Unmarshal(raw, &text) == nil:
+				values[column] = text
+			default:
+				values[column] = string(raw)
+			}
+		}
+		if err := collector.add(line, values); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return collector.result(), nil
+}
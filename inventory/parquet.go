@@ -0,0 +1,108 @@
+// inventory/parquet.go
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"ec2-restart-manager/models"
+
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Rows read from a Parquet export at a time
+const parquetBatchSize = 1000
+
+// ParquetDecoder decodes a Parquet export with one flat row per instance
+type ParquetDecoder struct {
+	mapping ColumnMapping
+}
+
+// Decode reads the Parquet rows into instances. Strings are used as they are, other
+// values as formatted by fmt, and null values are left out.
+func (d ParquetDecoder) Decode(content []byte) ([]models.EC2Instance, error) {
+	parquetReader, err := reader.NewParquetReader(newParquetBuffer(content), nil, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Parquet file: %w", err)
+	}
+	defer parquetReader.ReadStop()
+
+	// The reader names row fields after Go identifiers; map them back to the column names
+	columns := make(map[string]string)
+	for _, info := range parquetReader.SchemaHandler.Infos[1:] {
+		columns[info.InName] = info.ExName
+	}
+
+	collector := rowCollector{mapping: d.mapping}
+	total := int(parquetReader.GetNumRows())
+	for read := 0; read < total; {
+		rows, err := parquetReader.ReadByNumber(min(parquetBatchSize, total-read))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Parquet rows: %w", err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		for index, row := range rows {
+			value := reflect.Indirect(reflect.ValueOf(row))
+			if value.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("row %d is not a flat record", read+index+1)
+			}
+			values := make(map[string]string, value.NumField())
+			for field := 0; field < value.NumField(); field++ {
+				if text, ok := parquetValueString(value.Field(field)); ok {
+					values[columns[value.Type().Field(field).Name]] = text
+				}
+			}
+			if err := collector.add(read+index+1, values); err != nil {
+				return nil, err
+			}
+		}
+		read += len(rows)
+	}
+	return collector.result(), nil
+}
+
+// parquetValueString formats a column value, reporting false for null values
+func parquetValueString(value reflect.Value) (string, bool) {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return "", false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.String {
+		return value.String(), true
+	}
+	return fmt.Sprint(value.Interface()), true
+}
+
+// parquetBuffer is an in-memory Parquet file for the reader, which opens one copy per column
+type parquetBuffer struct {
+	*bytes.Reader
+	content []byte
+}
+
+func newParquetBuffer(content []byte) *parquetBuffer {
+	return &parquetBuffer{Reader: bytes.NewReader(content), content: content}
+}
+
+func (b *parquetBuffer) Open(name string) (source.ParquetFile, error) {
+	return newParquetBuffer(b.content), nil
+}
+
+func (b *parquetBuffer) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet buffer is read-only")
+}
+
+func (b *parquetBuffer) Write(p []byte) (int, error) {
+	return 0, errors.New("parquet buffer is read-only")
+}
+
+func (b *parquetBuffer) Close() error {
+	return nil
+}
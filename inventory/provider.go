@@ -0,0 +1,85 @@
+// inventory/provider.go
+package inventory
+
+import (
+	"errors"
+	"fmt"
+
+	"ec2-restart-manager/config"
+	"ec2-restart-manager/models"
+)
+
+// ErrNotModified is returned by Provider.Instances when the source has not changed since
+// the previous call
+var ErrNotModified = errors.New("inventory not modified")
+
+// Provider loads the current EC2 inventory from a source
+type Provider interface {
+	// Name describes the source, e.g. for logs
+	Name() string
+	// Instances returns the running instances known to the source, or ErrNotModified
+	Instances() ([]models.EC2Instance, error)
+	// Version identifies the data returned by the last successful call to Instances
+	Version() string
+}
+
+// Source is a provider and the name its instances are shown with
+type Source struct {
+	Name     string
+	Provider Provider
+}
+
+// NewSources creates the inventory sources selected in the configuration, in order of
+// precedence. Without a list of sources the single s3 or ec2 source is used.
+func NewSources(cfg *config.EnvConfig) ([]Source, error) {
+	sourceConfigs := cfg.Inventory.Sources
+	if len(sourceConfigs) == 0 {
+		sourceConfigs = []config.InventorySourceConfig{{
+			Type:    cfg.Inventory.Source,
+			Bucket:  cfg.S3.Bucket,
+			Key:     cfg.S3.Key,
+			Format:  cfg.Inventory.Format,
+			Mapping: cfg.Inventory.Mapping,
+			EC2:     cfg.Inventory.EC2,
+		}}
+	}
+
+	var sources []Source
+	names := make(map[string]bool)
+	for _, sourceConfig := range sourceConfigs {
+		provider, err := newProvider(sourceConfig)
+		if err != nil {
+			return nil, err
+		}
+		name := sourceConfig.Name
+		if name == "" {
+			name = provider.Name()
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate inventory source name %q", name)
+		}
+		names[name] = true
+		sources = append(sources, Source{Name: name, Provider: provider})
+	}
+	return sources, nil
+}
+
+// newProvider creates the provider of one inventory source
+func newProvider(cfg config.InventorySourceConfig) (Provider, error) {
+	switch cfg.Type {
+	case "", "s3":
+		mapping, err := NewColumnMapping(cfg.Mapping.Columns, cfg.Mapping.States)
+		if err != nil {
+			return nil, err
+		}
+		decoder, err := NewDecoder(cfg.Format, cfg.Key, mapping)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Provider(cfg.Bucket, cfg.Key, decoder), nil
+	case "ec2":
+		return NewEC2Provider(cfg.EC2)
+	default:
+		return nil, fmt.Errorf("unknown inventory source %q", cfg.Type)
+	}
+}
@@ -0,0 +1,211 @@
+// inventory/refresher.go
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ec2-restart-manager/models"
+)
+
+// SourceStatus describes the state of one inventory source
+type SourceStatus struct {
+	Name          string
+	Version       string    // Version of the loaded inventory, e.g. the S3 object version
+	Instances     int       // Number of instances loaded from the source
+	LastRefreshed time.Time // When the loaded inventory was fetched
+	LastError     string    // Error of the last check, if it failed
+}
+
+// RefreshStatus describes the state of the background inventory refresh
+type RefreshStatus struct {
+	Sources       []SourceStatus
+	Instances     int       // Number of instances after merging the sources
+	LastRefreshed time.Time // When the merged inventory last changed
+	LastChecked   time.Time // When the sources were last checked, changed or not
+	LastError     string    // Error of the last check, if every source failed
+}
+
+// FailedSources returns the sources whose last check failed
+func (s RefreshStatus) FailedSources() []SourceStatus {
+	var failed []SourceStatus
+	for _, source := range s.Sources {
+		if source.LastError != "" {
+			failed = append(failed, source)
+		}
+	}
+	return failed
+}
+
+// Refresher reloads the instance cache from its sources in the background, merging the
+// instances of all sources
+type Refresher struct {
+	sources   []Source
+	instances [][]models.EC2Instance // Last instances loaded from each source
+	interval  time.Duration
+
+	refreshMutex sync.Mutex // Serializes refreshes, since providers remember what they loaded
+	statusMutex  sync.Mutex
+	status       RefreshStatus
+}
+
+// NewRefresher creates a refresher checking the sources every interval. Sources are
+// given in order of precedence for instances listed by several of them.
+func NewRefresher(sources []Source, interval time.Duration) *Refresher {
+	refresher := &Refresher{
+		sources:   sources,
+		instances: make([][]models.EC2Instance, len(sources)),
+		interval:  interval,
+	}
+	for _, source := range sources {
+		refresher.status.Sources = append(refresher.status.Sources, SourceStatus{Name: source.Name})
+	}
+	return refresher
+}
+
+// Start loads the inventory once and then keeps refreshing it in the background
+func (r *Refresher) Start() {
+	if err := r.Refresh(); err != nil {
+		log.Printf("Error loading inventory: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := r.Refresh(); err != nil {
+				log.Printf("Error refreshing inventory: %v", err)
+			}
+		}
+	}()
+}
+
+// Refresh checks every source now and swaps in the merged instances if any source
+// changed. A source that fails keeps its previous instances; an error is only returned
+// when every source failed.
+func (r *Refresher) Refresh() error {
+	r.refreshMutex.Lock()
+	defer r.refreshMutex.Unlock()
+
+	now := time.Now()
+	results := make([]error, len(r.sources))
+	fetched := make([][]models.EC2Instance, len(r.sources))
+	var wg sync.WaitGroup
+	for index, source := range r.sources {
+		wg.Add(1)
+		go func(index int, source Source) {
+			defer wg.Done()
+			fetched[index], results[index] = source.Provider.Instances()
+		}(index, source)
+	}
+	wg.Wait()
+
+	r.statusMutex.Lock()
+	defer r.statusMutex.Unlock()
+	r.status.LastChecked = now
+
+	changed := false
+	var errs []string
+	for index, source := range r.sources {
+		status := &r.status.Sources[index]
+		err := results[index]
+		switch {
+		case errors.Is(err, ErrNotModified):
+			status.LastError = ""
+		case err != nil:
+			log.Printf("Error loading inventory from %s: %v", source.Name, err)
+			status.LastError = err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", source.Name, err))
+		default:
+			r.instances[index] = fetched[index]
+			status.Version = source.Provider.Version()
+			status.Instances = len(fetched[index])
+			status.LastRefreshed = now
+			status.LastError = ""
+			changed = true
+		}
+	}
+
+	if len(errs) == len(r.sources) {
+		r.status.LastError = strings.Join(errs, "; ")
+		return errors.New(r.status.LastError)
+	}
+	r.status.LastError = ""
+	if changed {
+		instances := r.merge()
+		diff := models.LoadInstances(instances, r.sourceNames(), r.versions())
+		r.status.Instances = len(instances)
+		r.status.LastRefreshed = now
+		log.Printf("Loaded %d instances from %s: %d added, %d removed, %d changed", len(instances), diff.Source,
+			diff.Count(models.InventoryAdded), diff.Count(models.InventoryRemoved), diff.Count(models.InventoryChanged))
+	} else {
+		models.MarkInventorySeen()
+	}
+
+	// The first refresh of each day keeps a snapshot for the trends of the uptime report
+	if err := models.RecordUptimeSnapshot(now); err != nil {
+		log.Printf("Error recording uptime snapshot: %v", err)
+	}
+	// Old jobs are dropped as they pass the retention period
+	if err := models.DeleteOldJobs(now); err != nil {
+		log.Printf("Error deleting old jobs: %v", err)
+	}
+	return nil
+}
+
+// merge combines the instances of all sources, tagging each with its source. An instance
+// listed by several sources is taken from the first of them.
+func (r *Refresher) merge() []models.EC2Instance {
+	seen := make(map[string]bool)
+	var merged []models.EC2Instance
+	duplicates := 0
+	for index, source := range r.sources {
+		for _, instance := range r.instances[index] {
+			if seen[instance.ID] {
+				duplicates++
+				continue
+			}
+			seen[instance.ID] = true
+			instance.Source = source.Name
+			merged = append(merged, instance)
+		}
+	}
+	if duplicates > 0 {
+		log.Printf("Ignored %d instances listed by more than one inventory source", duplicates)
+	}
+	return merged
+}
+
+// sourceNames lists the names of the sources
+func (r *Refresher) sourceNames() string {
+	var names []string
+	for _, source := range r.sources {
+		names = append(names, source.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// versions lists the loaded version of each source
+func (r *Refresher) versions() string {
+	if len(r.sources) == 1 {
+		return r.status.Sources[0].Version
+	}
+	var versions []string
+	for _, status := range r.status.Sources {
+		versions = append(versions, status.Name+"@"+status.Version)
+	}
+	return strings.Join(versions, ", ")
+}
+
+// Status returns the state of the refresh
+func (r *Refresher) Status() RefreshStatus {
+	r.statusMutex.Lock()
+	defer r.statusMutex.Unlock()
+	status := r.status
+	status.Sources = append([]SourceStatus(nil), r.status.Sources...)
+	return status
+}
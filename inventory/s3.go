@@ -0,0 +1,58 @@
+// inventory/s3.go
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"ec2-restart-manager/aws"
+	"ec2-restart-manager/models"
+)
+
+// S3Provider reads the inventory export written to S3 by a separate job
+type S3Provider struct {
+	bucket    string
+	key       string
+	decoder   Decoder
+	etag      string // ETag of the last object read, to skip unchanged objects
+	versionID string
+}
+
+// NewS3Provider creates a provider reading the export at bucket/key with decoder
+func NewS3Provider(bucket, key string, decoder Decoder) *S3Provider {
+	return &S3Provider{bucket: bucket, key: key, decoder: decoder}
+}
+
+// Name describes the source
+func (p *S3Provider) Name() string {
+	return fmt.Sprintf("s3://%s/%s", p.bucket, p.key)
+}
+
+// Instances fetches the export and returns the instances in the mapped states. The export is only
+// downloaded when its ETag changed since the previous call.
+func (p *S3Provider) Instances() ([]models.EC2Instance, error) {
+	object, err := aws.GetObjectIfChanged(p.bucket, p.key, p.etag)
+	if errors.Is(err, aws.ErrNotModified) {
+		return nil, ErrNotModified
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := p.decoder.Decode(object.Content)
+	if err != nil {
+		return nil, err
+	}
+	p.etag = object.ETag
+	p.versionID = object.VersionID
+	return instances, nil
+}
+
+// Version returns the object version if the bucket is versioned, otherwise its ETag
+func (p *S3Provider) Version() string {
+	if p.versionID != "" {
+		return p.versionID
+	}
+	return strings.Trim(p.etag, `"`)
+}
@@ -1,4 +1,3 @@
-// Modified code for main.go (relevant sections only)
 package main
 
 import (
@@ -7,15 +6,19 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"time"
 
 	"ec2-restart-manager/auth"
 	"ec2-restart-manager/aws"
 	"ec2-restart-manager/config"
 	"ec2-restart-manager/handlers"
+	"ec2-restart-manager/inventory"
 	"ec2-restart-manager/models"
 	"ec2-restart-manager/utils"
 
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v2"
 )
 
 var configSSMClient *ssm.Client
@@ -45,6 +48,61 @@ func main() {
 	handlers.InjectEnvironment(cfg.Environment)
 	models.InjectEnvName(cfg.Environment)
 
+	// Open the job store so that job history survives restarts
+	storagePath := cfg.Storage.Path
+	if storagePath == "" {
+		storagePath = "data/ec2-restart-manager.db"
+	}
+	jobStore, err := models.NewBoltJobStore(storagePath)
+	if err != nil {
+		log.Fatalf("Failed to open job store: %v", err)
+	}
+	defer jobStore.Close()
+	models.InjectJobStore(jobStore)
+	models.InjectAPIKeyStore(jobStore)
+	models.InjectUptimeSnapshotStore(jobStore)
+	if err := models.InterruptRunningJobs(); err != nil {
+		log.Printf("Error marking interrupted jobs: %v", err)
+	}
+	if err := models.DeleteOldJobs(time.Now()); err != nil {
+		log.Printf("Error deleting old jobs: %v", err)
+	}
+
+	// Set up the audit trail of user actions
+	auditStore, err := newAuditStore(cfg.Audit)
+	if err != nil {
+		log.Fatalf("Failed to set up audit store: %v", err)
+	}
+	models.InjectAuditStore(auditStore)
+
+	// Saved views are kept with the jobs or in Parameter Store
+	viewStore, err := newViewStore(cfg, jobStore)
+	if err != nil {
+		log.Fatalf("Failed to set up view store: %v", err)
+	}
+	models.InjectViewStore(viewStore)
+
+	// Approved commands come from the configuration or Parameter Store
+	commandLibrary, err := newCommandLibrary(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up command library: %v", err)
+	}
+	models.InjectCommandLibrary(commandLibrary)
+	var documents []models.SSMDocument
+	for _, document := range cfg.Command.Documents {
+		documents = append(documents, models.SSMDocument{
+			Name:            document.Name,
+			Description:     document.Description,
+			Type:            document.Type,
+			TargetParameter: document.TargetParameter,
+			Action:          document.Action,
+			Parameters:      document.Parameters,
+		})
+	}
+	if err := models.InjectSSMDocuments(documents); err != nil {
+		log.Fatalf("Failed to set up SSM documents: %v", err)
+	}
+
 	// Load the schedule config from Parameter Store
 	if err := models.LoadScheduleConfig(); err != nil {
 		log.Printf("Error loading schedule configuration: %v", err)
@@ -69,20 +127,53 @@ func main() {
 		os.Setenv("AZURE_AD_CLIENT_SECRET", secretValue)
 	}
 
+	// Select where the EC2 inventory comes from
+	inventorySources, err := inventory.NewSources(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up inventory sources: %v", err)
+	}
+	refreshInterval := time.Duration(cfg.Inventory.RefreshIntervalMinutes) * time.Minute
+	if refreshInterval <= 0 {
+		refreshInterval = 5 * time.Minute
+	}
+	inventoryRefresher := inventory.NewRefresher(inventorySources, refreshInterval)
+	inventoryRefresher.Start()
+	handlers.InjectInventoryRefresher(inventoryRefresher)
+
 	// Initialize authentication with the AzureAD config
-	auth.InitializeAuth(cfg)
+	if err := auth.InitializeAuth(cfg); err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
 
 	// Setup HTTP routes
 	http.HandleFunc("/", handlers.IndexHandler)
 	http.Handle("/restart", auth.AuthMiddleware(http.HandlerFunc(handlers.RestartHandler)))
+	http.Handle("/stop-start", auth.AuthMiddleware(http.HandlerFunc(handlers.StopStartHandler)))
+	http.Handle("/rollout", auth.AuthMiddleware(http.HandlerFunc(handlers.RolloutHandler)))
+	http.Handle("/rollouts", auth.AuthMiddleware(http.HandlerFunc(handlers.RolloutStatusHandler)))
+	http.Handle("/audit", auth.AuthMiddleware(http.HandlerFunc(handlers.AuditHandler)))
+	http.Handle("/audit/export", auth.AuthMiddleware(http.HandlerFunc(handlers.AuditExportHandler)))
 	http.HandleFunc("/about", handlers.AboutHandler)
+	http.Handle("/update", auth.AuthMiddleware(http.HandlerFunc(handlers.RefreshInventoryHandler)))
+	http.Handle("/views", auth.AuthMiddleware(http.HandlerFunc(handlers.SaveViewHandler)))
+	http.Handle("/views/delete", auth.AuthMiddleware(http.HandlerFunc(handlers.DeleteViewHandler)))
+	http.Handle("/reports/uptime", auth.AuthMiddleware(http.HandlerFunc(handlers.UptimeReportHandler)))
+	http.Handle("/reports/uptime.csv", auth.AuthMiddleware(http.HandlerFunc(handlers.UptimeReportExportHandler)))
+	http.Handle("/inventory/changes", auth.AuthMiddleware(http.HandlerFunc(handlers.InventoryChangesHandler)))
+	http.Handle("/inventory/events", auth.AuthMiddleware(http.HandlerFunc(handlers.InventoryEventsHandler)))
 	http.HandleFunc("/logout", auth.LogoutHandler)
 	http.HandleFunc("/access_denied", handlers.AccessDeniedHandler)
 	http.HandleFunc("/login", auth.LoginHandler)
 	http.HandleFunc("/auth/callback", auth.CallbackHandler)
-	http.HandleFunc("/status", handlers.StatusHandler)
+	http.Handle("/status", auth.AuthMiddleware(http.HandlerFunc(handlers.StatusHandler)))
 	http.Handle("/command", auth.AuthMiddleware(http.HandlerFunc(handlers.CommandHandler)))
-	http.HandleFunc("/command-status", handlers.CommandStatusHandler)
+	http.Handle("/command-status", auth.AuthMiddleware(http.HandlerFunc(handlers.CommandStatusHandler)))
+	http.Handle("/command-output", auth.AuthMiddleware(http.HandlerFunc(handlers.CommandOutputHandler)))
+	http.Handle("/command-cancel", auth.AuthMiddleware(http.HandlerFunc(handlers.CancelCommandHandler)))
+	http.Handle("/events", auth.AuthMiddleware(http.HandlerFunc(handlers.EventsHandler)))
+	handlers.RegisterAPIRoutes(http.DefaultServeMux)
+	http.Handle("/api-keys", auth.AdminMiddleware(http.HandlerFunc(handlers.APIKeysHandler)))
+	http.Handle("/api-keys/revoke", auth.AdminMiddleware(http.HandlerFunc(handlers.RevokeAPIKeyHandler)))
 	http.Handle("/config", auth.AuthMiddleware(http.HandlerFunc(handlers.ConfigHandler)))
 
 	// Start web server
@@ -90,3 +181,95 @@ func main() {
 	log.Printf("Server started at http://%s", address)
 	log.Fatal(http.ListenAndServe(address, nil))
 }
+
+// newAuditStore creates the audit store selected in the configuration
+func newAuditStore(auditCfg config.AuditConfig) (models.AuditStore, error) {
+	switch auditCfg.Type {
+	case "", "file":
+		path := auditCfg.Path
+		if path == "" {
+			path = "data/audit.jsonl"
+		}
+		return models.NewFileAuditStore(path)
+	case "s3":
+		if auditCfg.Bucket == "" {
+			return nil, fmt.Errorf("audit bucket is required for the s3 audit store")
+		}
+		prefix := auditCfg.Prefix
+		if prefix == "" {
+			prefix = "audit"
+		}
+		return models.NewS3AuditStore(auditCfg.Bucket, prefix), nil
+	default:
+		return nil, fmt.Errorf("unknown audit store type %q", auditCfg.Type)
+	}
+}
+
+// newViewStore creates the saved view store selected in the configuration
+func newViewStore(cfg *config.EnvConfig, jobStore *models.BoltJobStore) (models.ViewStore, error) {
+	switch cfg.Views.Store {
+	case "", "local":
+		return jobStore, nil
+	case "ssm":
+		return models.NewParameterViewStore(configSSMClient, fmt.Sprintf("/ec2-restart-manager/%s/views", cfg.Environment)), nil
+	default:
+		return nil, fmt.Errorf("unknown view store %q", cfg.Views.Store)
+	}
+}
+
+// newCommandLibrary builds the command library from the built-in commands and those of the
+// configuration or, with command.library_source ssm, of Parameter Store
+func newCommandLibrary(cfg *config.EnvConfig) (*models.CommandLibrary, error) {
+	entries := cfg.Command.Library
+	switch cfg.Command.LibrarySource {
+	case "", "config":
+	case "ssm":
+		path := fmt.Sprintf("/ec2-restart-manager/%s/commands", cfg.Environment)
+		parameters, err := aws.GetParametersByPath(configSSMClient, path)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(parameters))
+		for name := range parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		entries = nil
+		for _, name := range names {
+			var entry config.CommandTemplateConfig
+			if err := yaml.Unmarshal([]byte(parameters[name]), &entry); err != nil {
+				return nil, fmt.Errorf("invalid library command in parameter %s: %w", name, err)
+			}
+			entries = append(entries, entry)
+		}
+	default:
+		return nil, fmt.Errorf("unknown command library source %q", cfg.Command.LibrarySource)
+	}
+
+	var templates []models.CommandTemplate
+	for _, entry := range entries {
+		command := models.CommandTemplate{
+			Name:               entry.Name,
+			Description:        entry.Description,
+			Template:           entry.Template,
+			EnvironmentClasses: entry.EnvironmentClasses,
+			Role:               entry.Role,
+		}
+		for _, parameter := range entry.Parameters {
+			command.Parameters = append(command.Parameters, models.CommandParameter{
+				Name:        parameter.Name,
+				Label:       parameter.Label,
+				Description: parameter.Description,
+				Type:        parameter.Type,
+				Required:    parameter.Required,
+				Default:     parameter.Default,
+				Pattern:     parameter.Pattern,
+				Min:         parameter.Min,
+				Max:         parameter.Max,
+				Options:     parameter.Options,
+			})
+		}
+		templates = append(templates, command)
+	}
+	return models.NewCommandLibrary(templates)
+}
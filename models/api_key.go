@@ -0,0 +1,166 @@
+// models/api_key.go
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Prefix of locally issued API keys, used to tell them apart from Azure AD tokens
+const APIKeyPrefix = "erm_"
+
+// APIKey is a locally issued, scoped credential for non-interactive callers.
+// Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Hint               string    `json:"hint"` // First characters of the key, to recognise it
+	Hash               string    `json:"hash"`
+	Scopes             []string  `json:"scopes"`                        // Actions the key may perform
+	AccountNames       []string  `json:"account_names,omitempty"`       // Instances the key may act on, like the filters
+	EnvironmentClasses []string  `json:"environment_classes,omitempty"` // of a role; empty matches every instance
+	Services           []string  `json:"services,omitempty"`
+	Owners             []string  `json:"owners,omitempty"`
+	CreatedBy          string    `json:"created_by"`
+	CreatedAt          time.Time `json:"created_at"`
+	LastUsedAt         time.Time `json:"last_used_at"`
+	RevokedBy          string    `json:"revoked_by,omitempty"`
+	RevokedAt          time.Time `json:"revoked_at"`
+}
+
+// Grant returns what the key allows, as a role of its own
+func (k *APIKey) Grant() Grant {
+	return Grant{
+		Role:               "api-key",
+		Actions:            k.Scopes,
+		AccountNames:       k.AccountNames,
+		EnvironmentClasses: k.EnvironmentClasses,
+		Services:           k.Services,
+		Owners:             k.Owners,
+	}
+}
+
+// Revoked checks if the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// APIKeyStore persists API keys
+type APIKeyStore interface {
+	SaveAPIKey(key *APIKey) error
+	// GetAPIKeyByHash retrieves a key by the hash of its secret
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	// UpdateAPIKey atomically applies change to the stored key
+	UpdateAPIKey(id string, change func(*APIKey)) error
+	// ListAPIKeys returns all keys, newest first
+	ListAPIKeys() ([]*APIKey, error)
+}
+
+var apiKeyStore APIKeyStore
+
+// InjectAPIKeyStore injects the store used for API keys
+func InjectAPIKeyStore(store APIKeyStore) {
+	apiKeyStore = store
+}
+
+// CreateAPIKey issues a new key allowing the actions of scope on the instances its filters
+// match. The returned secret is only available now; afterwards just its hash is kept.
+func CreateAPIKey(name, createdBy string, scope Grant) (*APIKey, string, error) {
+	scopes := scope.Actions
+	if apiKeyStore == nil {
+		return nil, "", fmt.Errorf("API key store not initialized")
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("API key name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("API key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !containsString(AllActions, scope) {
+			return nil, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	key := &APIKey{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Hint:      secret[:len(APIKeyPrefix)+6],
+		Hash:      hashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+
+		AccountNames:       scope.AccountNames,
+		EnvironmentClasses: scope.EnvironmentClasses,
+		Services:           scope.Services,
+		Owners:             scope.Owners,
+	}
+	if err := apiKeyStore.SaveAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// AuthenticateAPIKey returns the active key matching secret and records its use
+func AuthenticateAPIKey(secret string) (*APIKey, error) {
+	if apiKeyStore == nil || !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, fmt.Errorf("invalid API key")
+	}
+
+	key, err := apiKeyStore.GetAPIKeyByHash(hashAPIKey(secret))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if key.Revoked() {
+		return nil, fmt.Errorf("API key %s has been revoked", key.Name)
+	}
+
+	now := time.Now()
+	apiKeyStore.UpdateAPIKey(key.ID, func(k *APIKey) {
+		k.LastUsedAt = now
+	})
+	key.LastUsedAt = now
+	return key, nil
+}
+
+// RevokeAPIKey revokes a key so that it can no longer be used
+func RevokeAPIKey(id, revokedBy string) error {
+	if apiKeyStore == nil {
+		return fmt.Errorf("API key store not initialized")
+	}
+	return apiKeyStore.UpdateAPIKey(id, func(k *APIKey) {
+		if !k.Revoked() {
+			k.RevokedBy = revokedBy
+			k.RevokedAt = time.Now()
+		}
+	})
+}
+
+// ListAPIKeys returns all API keys, newest first
+func ListAPIKeys() ([]*APIKey, error) {
+	if apiKeyStore == nil {
+		return nil, nil
+	}
+	return apiKeyStore.ListAPIKeys()
+}
+
+// hashAPIKey hashes a key secret for storage. Keys are long random strings, so a
+// plain SHA-256 is enough.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
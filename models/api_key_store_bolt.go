@@ -0,0 +1,116 @@
+// models/api_key_store_bolt.go
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// API keys are stored by ID, with an index from key hash to ID. The buckets are created with
+// the first key.
+var (
+	apiKeysBucket      = []byte("api_keys")
+	apiKeyHashesBucket = []byte("api_key_hashes")
+)
+
+// SaveAPIKey stores an API key, replacing any key with the same ID
+func (s *BoltJobStore) SaveAPIKey(key *APIKey) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := putAPIKey(tx, key); err != nil {
+			return err
+		}
+		hashes, err := tx.CreateBucketIfNotExists(apiKeyHashesBucket)
+		if err != nil {
+			return err
+		}
+		return hashes.Put([]byte(key.Hash), []byte(key.ID))
+	})
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its secret
+func (s *BoltJobStore) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	var key *APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var id []byte
+		if hashes := tx.Bucket(apiKeyHashesBucket); hashes != nil {
+			id = hashes.Get([]byte(hash))
+		}
+		if id == nil {
+			return fmt.Errorf("API key not found")
+		}
+		var err error
+		key, err = getAPIKey(tx, string(id))
+		return err
+	})
+	return key, err
+}
+
+// UpdateAPIKey applies change to an API key within a single transaction
+func (s *BoltJobStore) UpdateAPIKey(id string, change func(*APIKey)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key, err := getAPIKey(tx, id)
+		if err != nil {
+			return err
+		}
+		change(key)
+		return putAPIKey(tx, key)
+	})
+}
+
+// ListAPIKeys returns all API keys, newest first
+func (s *BoltJobStore) ListAPIKeys() ([]*APIKey, error) {
+	var keys []*APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(apiKeysBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			var key APIKey
+			if err := json.Unmarshal(value, &key); err != nil {
+				return fmt.Errorf("failed to unmarshal API key: %w", err)
+			}
+			keys = append(keys, &key)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func getAPIKey(tx *bolt.Tx, id string) (*APIKey, error) {
+	var value []byte
+	if bucket := tx.Bucket(apiKeysBucket); bucket != nil {
+		value = bucket.Get([]byte(id))
+	}
+	if value == nil {
+		return nil, fmt.Errorf("API key %s not found", id)
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(value, &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key %s: %w", id, err)
+	}
+	return &key, nil
+}
+
+func putAPIKey(tx *bolt.Tx, key *APIKey) error {
+	value, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal API key %s: %w", key.ID, err)
+	}
+	bucket, err := tx.CreateBucketIfNotExists(apiKeysBucket)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key.ID), value)
+}
@@ -0,0 +1,224 @@
+// models/audit.go
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ec2-restart-manager/aws"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records one action taken by a user on an instance
+type AuditEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	User        string    `json:"user"`
+	Action      string    `json:"action"` // Job type, e.g. "restart" or "command"
+	Description string    `json:"description"`
+	JobID       string    `json:"job_id"`
+	InstanceID  string    `json:"instance_id"`
+	AccountID   string    `json:"account_id"`
+	AccountName string    `json:"account_name"`
+	Region      string    `json:"region"`
+	Command     string    `json:"command,omitempty"`
+	CommandID   string    `json:"command_id,omitempty"`
+	Outcome     string    `json:"outcome"` // "Requested" when the action starts, the final status when it ends
+	CancelledBy string    `json:"cancelled_by,omitempty"`
+}
+
+// AuditStore is an append-only log of audit entries
+type AuditStore interface {
+	Append(entry AuditEntry) error
+	// List returns all entries, newest first
+	List() ([]AuditEntry, error)
+}
+
+// Outcome recorded when an action is started
+const AuditOutcomeRequested = "Requested"
+
+var auditStore AuditStore
+
+// InjectAuditStore injects the store used for the audit trail
+func InjectAuditStore(store AuditStore) {
+	auditStore = store
+}
+
+// ListAuditEntries returns the whole audit trail, newest first
+func ListAuditEntries() ([]AuditEntry, error) {
+	if auditStore == nil {
+		return nil, nil
+	}
+	return auditStore.List()
+}
+
+// recordAudit appends an audit entry for a task of a job, logging failures since the
+// action itself has already happened
+func recordAudit(job *Job, task Task, outcome string) {
+	if auditStore == nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Timestamp:   time.Now(),
+		User:        job.User,
+		Action:      job.Type,
+		Description: job.Description,
+		JobID:       job.ID,
+		InstanceID:  task.InstanceID,
+		AccountID:   task.AWSAccountNumber,
+		AccountName: task.AWSAccountName,
+		Region:      task.Region,
+		Command:     task.Command,
+		CommandID:   task.CommandID,
+		Outcome:     outcome,
+		CancelledBy: task.CancelledBy,
+	}
+	if err := auditStore.Append(entry); err != nil {
+		log.Printf("Failed to record audit entry for instance %s in job %s: %v", task.InstanceID, job.ID, err)
+	}
+}
+
+// Matches reports whether any field of the entry contains the query, ignoring case
+func (e AuditEntry) Matches(query string) bool {
+	if query == "" {
+		return true
+	}
+	query = strings.ToLower(query)
+	for _, field := range []string{e.User, e.Action, e.Description, e.JobID, e.InstanceID, e.AccountID,
+		e.AccountName, e.Region, e.Command, e.CommandID, e.Outcome, e.CancelledBy} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileAuditStore appends audit entries as JSON lines to a local file
+type FileAuditStore struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileAuditStore creates an audit store writing to the JSONL file at path
+func NewFileAuditStore(path string) (*FileAuditStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for audit log: %w", err)
+	}
+	return &FileAuditStore{path: path}, nil
+}
+
+// Append writes an entry to the end of the audit log
+func (s *FileAuditStore) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// List reads all entries from the audit log
+func (s *FileAuditStore) List() ([]AuditEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Entries with long commands exceed the default buffer
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log %s: %w", s.path, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", s.path, err)
+	}
+
+	sortAuditEntries(entries)
+	return entries, nil
+}
+
+// S3AuditStore writes each audit entry as its own object, so entries are never rewritten
+type S3AuditStore struct {
+	bucket string
+	prefix string
+}
+
+// NewS3AuditStore creates an audit store writing to the given S3 bucket and key prefix
+func NewS3AuditStore(bucket, prefix string) *S3AuditStore {
+	return &S3AuditStore{bucket: bucket, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// Append uploads an entry as a new object keyed by date and time
+func (s *S3AuditStore) Append(entry AuditEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	key := fmt.Sprintf("%s/%s/%s-%s.json", s.prefix, entry.Timestamp.UTC().Format("2006/01/02"),
+		entry.Timestamp.UTC().Format("150405.000000000"), uuid.NewString())
+	return aws.PutObjectToS3(s.bucket, key, content)
+}
+
+// List downloads all entries below the prefix
+func (s *S3AuditStore) List() ([]AuditEntry, error) {
+	keys, err := aws.ListS3Keys(s.bucket, s.prefix+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, key := range keys {
+		content, err := aws.GetObjectFromS3(s.bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit entry %s: %w", key, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	sortAuditEntries(entries)
+	return entries, nil
+}
+
+// sortAuditEntries orders entries newest first
+func sortAuditEntries(entries []AuditEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+}
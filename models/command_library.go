@@ -0,0 +1,314 @@
+// models/command_library.go
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Types of library command parameters
+const (
+	ParameterString  = "string"
+	ParameterInteger = "integer"
+	ParameterBoolean = "boolean"
+	ParameterChoice  = "choice"
+)
+
+// Names of library commands and parameters, which are also used in form field names
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// CommandParameter is a typed parameter of a library command
+type CommandParameter struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Default     string   `json:"default,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"` // Regular expression a string must match in full
+	Min         *int     `json:"min,omitempty"`
+	Max         *int     `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"` // Values of a choice
+
+	pattern *regexp.Regexp
+}
+
+// CommandTemplate is an approved command that operators run by filling in its parameters
+// rather than typing shell
+type CommandTemplate struct {
+	Name               string             `json:"name"`
+	Description        string             `json:"description"`
+	Template           string             `json:"template"` // Shell command, with parameters as {{ .name }}
+	Parameters         []CommandParameter `json:"parameters"`
+	EnvironmentClasses []string           `json:"environment_classes,omitempty"` // Empty allows every environment class
+	Role               string             `json:"role,omitempty"`                // Role allowed to run it without the command action
+
+	template *template.Template
+}
+
+// DefaultCommandTemplates are the built-in library commands; the configuration can override
+// them or add more
+var DefaultCommandTemplates = []CommandTemplate{
+	{
+		Name:        "restart-service",
+		Description: "Restart a systemd service",
+		Template:    "sudo systemctl restart {{ .service }} && sudo systemctl --no-pager status {{ .service }}",
+		Parameters: []CommandParameter{
+			{Name: "service", Label: "Service", Type: ParameterString, Required: true, Pattern: `[A-Za-z0-9@._-]+`},
+		},
+	},
+	{
+		Name:        "clear-tmp",
+		Description: "Delete files in /tmp that have not been modified for a number of days",
+		Template:    "sudo find /tmp -xdev -type f -mtime +{{ .days }} -delete && df -h /tmp",
+		Parameters: []CommandParameter{
+			{Name: "days", Label: "Older than (days)", Type: ParameterInteger, Required: true, Default: "7", Min: intPointer(1), Max: intPointer(365)},
+		},
+	},
+	{
+		Name:        "collect-diagnostics",
+		Description: "Show uptime, load, memory, disk usage and recent errors",
+		Template:    "uptime; free -m; df -h; sudo journalctl --no-pager -p err -n {{ .lines }}",
+		Parameters: []CommandParameter{
+			{Name: "lines", Label: "Log lines", Type: ParameterInteger, Default: "50", Min: intPointer(1), Max: intPointer(1000)},
+		},
+	},
+}
+
+// CommandLibrary is the set of approved commands, by name
+type CommandLibrary struct {
+	templates map[string]*CommandTemplate
+}
+
+// NewCommandLibrary builds a library from the built-in commands and the configured ones,
+// checking every template and parameter
+func NewCommandLibrary(configured []CommandTemplate) (*CommandLibrary, error) {
+	library := &CommandLibrary{templates: make(map[string]*CommandTemplate)}
+	for _, command := range append(append([]CommandTemplate{}, DefaultCommandTemplates...), configured...) {
+		command := command
+		if err := command.prepare(); err != nil {
+			return nil, err
+		}
+		library.templates[command.Name] = &command
+	}
+	return library, nil
+}
+
+// List returns the commands sorted by name
+func (l *CommandLibrary) List() []*CommandTemplate {
+	var commands []*CommandTemplate
+	for _, command := range l.templates {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// Get returns the command with the given name
+func (l *CommandLibrary) Get(name string) (*CommandTemplate, bool) {
+	command, exists := l.templates[name]
+	return command, exists
+}
+
+var commandLibrary *CommandLibrary
+
+// InjectCommandLibrary injects the library of approved commands
+func InjectCommandLibrary(library *CommandLibrary) {
+	commandLibrary = library
+}
+
+// ListCommandTemplates returns the library commands sorted by name
+func ListCommandTemplates() []*CommandTemplate {
+	if commandLibrary == nil {
+		return nil
+	}
+	return commandLibrary.List()
+}
+
+// GetCommandTemplate returns the library command with the given name
+func GetCommandTemplate(name string) (*CommandTemplate, bool) {
+	if commandLibrary == nil {
+		return nil, false
+	}
+	return commandLibrary.Get(name)
+}
+
+// prepare checks the command and compiles its template and parameter patterns
+func (c *CommandTemplate) prepare() error {
+	if !commandNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("library command %q needs a name of lowercase letters, digits, - and _", c.Name)
+	}
+	parsed, err := template.New(c.Name).Option("missingkey=error").Parse(c.Template)
+	if err != nil {
+		return fmt.Errorf("library command %s has an invalid template: %w", c.Name, err)
+	}
+	c.template = parsed
+
+	seen := make(map[string]bool)
+	parameters := make([]CommandParameter, 0, len(c.Parameters))
+	for _, parameter := range c.Parameters {
+		if !commandNamePattern.MatchString(parameter.Name) || strings.Contains(parameter.Name, "-") {
+			return fmt.Errorf("library command %s has a parameter named %q; use lowercase letters, digits and _", c.Name, parameter.Name)
+		}
+		if seen[parameter.Name] {
+			return fmt.Errorf("library command %s has parameter %s twice", c.Name, parameter.Name)
+		}
+		seen[parameter.Name] = true
+
+		if parameter.Type == "" {
+			parameter.Type = ParameterString
+		}
+		if parameter.Label == "" {
+			parameter.Label = parameter.Name
+		}
+		switch parameter.Type {
+		case ParameterString:
+			if parameter.Pattern != "" {
+				if parameter.pattern, err = regexp.Compile(`^(?:` + parameter.Pattern + `)$`); err != nil {
+					return fmt.Errorf("library command %s parameter %s has an invalid pattern: %w", c.Name, parameter.Name, err)
+				}
+			}
+		case ParameterChoice:
+			if len(parameter.Options) == 0 {
+				return fmt.Errorf("library command %s parameter %s is a choice without options", c.Name, parameter.Name)
+			}
+		case ParameterInteger, ParameterBoolean:
+		default:
+			return fmt.Errorf("library command %s parameter %s has unknown type %q", c.Name, parameter.Name, parameter.Type)
+		}
+		if parameter.Default != "" {
+			if _, err := parameter.value(parameter.Default); err != nil {
+				return fmt.Errorf("library command %s has an invalid default: %w", c.Name, err)
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	c.Parameters = parameters
+
+	// Render with the values Render passes for empty parameters and for the defaults, to find
+	// parameters the template lacks and expressions that fail on those values
+	empty := make(map[string]interface{})
+	defaults := make(map[string]interface{})
+	for _, parameter := range c.Parameters {
+		empty[parameter.Name] = parameter.templateValue("")
+		value, _ := parameter.value(parameter.Default)
+		defaults[parameter.Name] = parameter.templateValue(value)
+	}
+	for _, sample := range []map[string]interface{}{empty, defaults} {
+		if err := c.template.Execute(&bytes.Buffer{}, sample); err != nil {
+			return fmt.Errorf("library command %s has a template that fails with empty or default values: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// AllowsEnvironment checks if the command may run in an environment class
+func (c *CommandTemplate) AllowsEnvironment(environmentClass string) bool {
+	return matchesFilter(c.EnvironmentClasses, environmentClass)
+}
+
+// Render validates the parameter values and returns the shell command. Strings and choices are
+// single-quoted for the shell, so they cannot inject commands of their own; integers and
+// booleans are passed as numbers and bools, e.g. for {{ if .force }}. An optional integer
+// left empty is 0, so that {{ if gt .count 0 }} tells whether it was given.
+func (c *CommandTemplate) Render(values map[string]string) (string, error) {
+	data, err := c.templateData(values)
+	if err != nil {
+		return "", err
+	}
+
+	var command bytes.Buffer
+	if err := c.template.Execute(&command, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", c.Name, err)
+	}
+	return command.String(), nil
+}
+
+// templateData validates the parameter values and converts them for the template
+func (c *CommandTemplate) templateData(values map[string]string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, parameter := range c.Parameters {
+		value, err := parameter.value(values[parameter.Name])
+		if err != nil {
+			return nil, err
+		}
+		data[parameter.Name] = parameter.templateValue(value)
+	}
+	return data, nil
+}
+
+// templateValue converts a validated value for the template: a bool, an int, 0 for an empty
+// integer, or a shell-quoted string
+func (p CommandParameter) templateValue(value string) interface{} {
+	switch p.Type {
+	case ParameterBoolean:
+		return value == "true"
+	case ParameterInteger:
+		number, _ := strconv.Atoi(value)
+		return number
+	default:
+		return shellQuote(value)
+	}
+}
+
+// value validates a parameter value, returning the default for an empty one
+func (p CommandParameter) value(raw string) (string, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		value = p.Default
+	}
+	if value == "" {
+		if p.Required {
+			return "", fmt.Errorf("%s is required", p.Label)
+		}
+		if p.Type == ParameterBoolean {
+			return "false", nil
+		}
+		return "", nil
+	}
+
+	switch p.Type {
+	case ParameterInteger:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a whole number", p.Label)
+		}
+		if p.Min != nil && number < *p.Min {
+			return "", fmt.Errorf("%s must be at least %d", p.Label, *p.Min)
+		}
+		if p.Max != nil && number > *p.Max {
+			return "", fmt.Errorf("%s must be at most %d", p.Label, *p.Max)
+		}
+		return strconv.Itoa(number), nil
+	case ParameterBoolean:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", p.Label)
+		}
+		return strconv.FormatBool(enabled), nil
+	case ParameterChoice:
+		if !containsString(p.Options, value) {
+			return "", fmt.Errorf("%s must be one of %s", p.Label, strings.Join(p.Options, ", "))
+		}
+	default:
+		if p.pattern != nil && !p.pattern.MatchString(value) {
+			return "", fmt.Errorf("%s must match %s", p.Label, p.Pattern)
+		}
+	}
+	return value, nil
+}
+
+// shellQuote quotes a value as a single shell word
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// intPointer returns a pointer to n, for optional bounds
+func intPointer(n int) *int {
+	return &n
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	values := []string{
+		"",
+		"plain",
+		"it's",
+		"'; rm -rf / #",
+		"$(reboot)",
+		"`reboot`",
+		"a; reboot",
+		"a && reboot",
+		"line\nbreak",
+		`back\slash "double"`,
+	}
+	for _, value := range values {
+		t.Run(value, func(t *testing.T) {
+			quoted := shellQuote(value)
+			if !strings.HasPrefix(quoted, "'") || !strings.HasSuffix(quoted, "'") {
+				t.Fatalf("%q is not single-quoted: %s", value, quoted)
+			}
+			// The shell must see exactly one word with the original value
+			output, err := exec.Command("sh", "-c", `printf '%s|' `+quoted).Output()
+			if err != nil {
+				t.Skipf("no shell to check with: %v", err)
+			}
+			if got := string(output); got != value+"|" {
+				t.Errorf("shell saw %q, want %q", got, value+"|")
+			}
+		})
+	}
+}
+
+// testLibraryCommand is a library command with one parameter of each kind
+var testLibraryCommand = CommandTemplate{
+	Name:     "test-command",
+	Template: "run --name {{ .name }} --count {{ .count }}{{ if .force }} --force{{ end }} --mode {{ .mode }}{{ if gt .limit 0 }} --limit {{ .limit }}{{ end }}",
+	Parameters: []CommandParameter{
+		{Name: "name", Type: ParameterString, Required: true, Pattern: `[a-z]+(-[a-z]+)*`},
+		{Name: "count", Type: ParameterInteger, Default: "5", Min: intPointer(1), Max: intPointer(10)},
+		{Name: "force", Type: ParameterBoolean},
+		{Name: "mode", Type: ParameterChoice, Default: "safe", Options: []string{"safe", "fast"}},
+		{Name: "limit", Type: ParameterInteger},
+	},
+}
+
+func TestRenderLibraryCommand(t *testing.T) {
+	library, err := NewCommandLibrary([]CommandTemplate{testLibraryCommand})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	command, _ := library.Get("test-command")
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr string
+	}{
+		{"defaults", map[string]string{"name": "web"},
+			"run --name 'web' --count 5 --mode 'safe'", ""},
+		{"every value", map[string]string{"name": "web-api", "count": " 10 ", "force": "true", "mode": "fast", "limit": "3"},
+			"run --name 'web-api' --count 10 --force --mode 'fast' --limit 3", ""},
+		{"boolean spellings", map[string]string{"name": "web", "force": "1"},
+			"run --name 'web' --count 5 --force --mode 'safe'", ""},
+
+		// Required and defaults
+		{"required missing", map[string]string{}, "", "name is required"},
+		{"required blank", map[string]string{"name": "  "}, "", "name is required"},
+
+		// Patterns match the whole value
+		{"pattern prefix only", map[string]string{"name": "web; reboot"}, "", "name must match"},
+		{"pattern suffix only", map[string]string{"name": "$(reboot)web"}, "", "name must match"},
+		{"pattern newline", map[string]string{"name": "web\nreboot"}, "", "name must match"},
+
+		// Integers
+		{"integer below min", map[string]string{"name": "web", "count": "0"}, "", "count must be at least 1"},
+		{"integer above max", map[string]string{"name": "web", "count": "11"}, "", "count must be at most 10"},
+		{"integer not a number", map[string]string{"name": "web", "count": "5; reboot"}, "", "count must be a whole number"},
+		{"integer decimal", map[string]string{"name": "web", "count": "2.5"}, "", "count must be a whole number"},
+
+		// Booleans and choices
+		{"boolean invalid", map[string]string{"name": "web", "force": "yes please"}, "", "force must be true or false"},
+		{"choice invalid", map[string]string{"name": "web", "mode": "safe; reboot"}, "", "mode must be one of safe, fast"},
+		{"choice case", map[string]string{"name": "web", "mode": "SAFE"}, "", "mode must be one of safe, fast"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered, err := command.Render(test.values)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got %q, %v; want error containing %q", rendered, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rendered != test.want {
+				t.Errorf("rendered %q, want %q", rendered, test.want)
+			}
+		})
+	}
+}
+
+func TestPrepareLibraryCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command CommandTemplate
+		wantErr string
+	}{
+		{"valid", testLibraryCommand, ""},
+		{"unknown parameter", CommandTemplate{Name: "bad", Template: "echo {{ .missing }}"}, "fails with empty or default values"},
+		{"unknown parameter in branch", CommandTemplate{
+			Name: "bad", Template: "echo{{ if .verbose }} {{ .level }}{{ end }}",
+			Parameters: []CommandParameter{{Name: "verbose", Type: ParameterBoolean, Default: "true"}},
+		}, "fails with empty or default values"},
+		{"string compared as number", CommandTemplate{
+			Name: "bad", Template: "echo{{ if gt .count 0 }} {{ .count }}{{ end }}",
+			Parameters: []CommandParameter{{Name: "count"}},
+		}, "fails with empty or default values"},
+		{"invalid template", CommandTemplate{Name: "bad", Template: "echo {{ .name "}, "invalid template"},
+		{"invalid name", CommandTemplate{Name: "Bad Name", Template: "echo"}, "needs a name"},
+		{"invalid parameter name", CommandTemplate{
+			Name: "bad", Template: "echo", Parameters: []CommandParameter{{Name: "a-b"}},
+		}, "has a parameter named"},
+		{"duplicate parameter", CommandTemplate{
+			Name: "bad", Template: "echo {{ .a }}", Parameters: []CommandParameter{{Name: "a"}, {Name: "a"}},
+		}, "twice"},
+		{"unknown type", CommandTemplate{
+			Name: "bad", Template: "echo {{ .a }}", Parameters: []CommandParameter{{Name: "a", Type: "float"}},
+		}, "unknown type"},
+		{"choice without options", CommandTemplate{
+			Name: "bad", Template: "echo {{ .a }}", Parameters: []CommandParameter{{Name: "a", Type: ParameterChoice}},
+		}, "without options"},
+		{"invalid pattern", CommandTemplate{
+			Name: "bad", Template: "echo {{ .a }}", Parameters: []CommandParameter{{Name: "a", Pattern: "("}},
+		}, "invalid pattern"},
+		{"default out of range", CommandTemplate{
+			Name: "bad", Template: "echo {{ .a }}", Parameters: []CommandParameter{{Name: "a", Type: ParameterInteger, Default: "0", Min: intPointer(1)}},
+		}, "invalid default"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewCommandLibrary([]CommandTemplate{test.command})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultCommandTemplates(t *testing.T) {
+	library, err := NewCommandLibrary(nil)
+	if err != nil {
+		t.Fatalf("built-in commands are invalid: %v", err)
+	}
+	command, _ := library.Get("restart-service")
+	if _, err := command.Render(map[string]string{"service": "nginx; reboot"}); err == nil {
+		t.Error("restart-service accepted a service name with shell syntax")
+	}
+	rendered, err := command.Render(map[string]string{"service": "nginx"})
+	if err != nil || rendered != "sudo systemctl restart 'nginx' && sudo systemctl --no-pager status 'nginx'" {
+		t.Errorf("rendered %q, %v", rendered, err)
+	}
+}
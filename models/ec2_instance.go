@@ -3,25 +3,104 @@ package models
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
-
+// EC2Instance is an instance of the inventory. The named fields can be read from any CSV
+// column or tag; any other column of the inventory is kept in Tags.
 type EC2Instance struct {
-	AWSAccountName   string `csv:"AWS Account Name"`
-	AWSAccountNumber string `csv:"AWS Account ID"`
-	State            string `csv:"State"`
-	UptimeDays  	 string `csv:"Uptime Days"`
-	EC2Name          string `csv:"EC2 Name"`
-	Service          string `csv:"Service"`
-	Owner            string `csv:"Owner"`
-	ID               string `csv:"ID"`
-	Region           string `csv:"Region"`
-	EnvironmentClass string `csv:"EnvironmentClass"`
-    CommandOutput    string  // Output of the most recent command execution
-    CommandTimestamp string  // When the command was executed
-    Command          string  // The command that was executed
-	RestartTimestamp string 
-	// Add other fields as needed
+	AWSAccountName   string            `json:"aws_account_name"`
+	AWSAccountNumber string            `json:"aws_account_number"`
+	State            string            `json:"state"`
+	UptimeDays       string            `json:"uptime_days"`
+	EC2Name          string            `json:"name"`
+	Service          string            `json:"service"`
+	Owner            string            `json:"owner"`
+	ID               string            `json:"id"`
+	Region           string            `json:"region"`
+	EnvironmentClass string            `json:"environment_class"`
+	Tags             map[string]string `json:"tags,omitempty"` // Unmapped columns, e.g. platform or patch group
+	Source           string            `json:"source"`         // Name of the inventory source the instance came from
+}
+
+// InstanceFields names the fields of EC2Instance, as used in the inventory configuration
+var InstanceFields = []string{
+	"aws_account_name", "aws_account_number", "state", "uptime_days", "name",
+	"service", "owner", "id", "region", "environment_class",
+}
+
+// instanceField returns a pointer to the named field, or nil for an unknown name
+func (i *EC2Instance) instanceField(name string) *string {
+	switch name {
+	case "aws_account_name":
+		return &i.AWSAccountName
+	case "aws_account_number":
+		return &i.AWSAccountNumber
+	case "state":
+		return &i.State
+	case "uptime_days":
+		return &i.UptimeDays
+	case "name":
+		return &i.EC2Name
+	case "service":
+		return &i.Service
+	case "owner":
+		return &i.Owner
+	case "id":
+		return &i.ID
+	case "region":
+		return &i.Region
+	case "environment_class":
+		return &i.EnvironmentClass
+	case "source":
+		return &i.Source
+	}
+	return nil
+}
+
+// SetField sets the named field, reporting false if there is no such field
+func (i *EC2Instance) SetField(name, value string) bool {
+	field := i.instanceField(name)
+	if field == nil {
+		return false
+	}
+	*field = value
+	return true
+}
+
+// Field returns the named field, or else the tag with that name
+func (i EC2Instance) Field(name string) string {
+	if field := i.instanceField(name); field != nil {
+		return *field
+	}
+	return i.Tags[name]
+}
+
+// IsRunning checks if the instance is running; instances without a state are assumed to be
+func (i EC2Instance) IsRunning() bool {
+	return i.State == "" || strings.EqualFold(i.State, "running")
+}
+
+// Uptime returns the uptime of the instance in days, if known
+func (i EC2Instance) Uptime() (float64, bool) {
+	days, err := ParseNumber(i.UptimeDays)
+	return days, err == nil
+}
+
+// ParseNumber parses a number such as the uptime in days of an instance. The filters, the
+// filter expressions, sorting, the uptime report and its snapshots all use it, so that they
+// agree on which instances have which uptime.
+func ParseNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return number, nil
 }
 
 type TemplateData struct {
@@ -42,33 +121,3 @@ type TemplateData struct {
 	StatusMap              map[string]string 
 	Data				   map[string]interface{}
 }
-
-// Global cache to store EC2 instances by their ID
-var instanceCache = make(map[string]EC2Instance)
-
-// LoadInstances populates the instance cache from a slice of EC2Instance structs
-func LoadInstances(instances []EC2Instance) {
-	for _, instance := range instances {
-		instanceCache[instance.ID] = instance
-	}
-}
-
-// GetInstanceDetails retrieves the details of an EC2 instance by its ID
-func GetInstanceDetails(instanceID string) (*EC2Instance, error) {
-	instance, exists := instanceCache[instanceID]
-	if !exists {
-		return nil, fmt.Errorf("instance ID %s not found", instanceID)
-	}
-	return &instance, nil
-}
-
-// GetInstances retrieves all EC2 instances from the global instance cache
-func GetInstances() []EC2Instance {
-	instances := make([]EC2Instance, 0, len(instanceCache))
-	for _, instance := range instanceCache {
-		instances = append(instances, instance)
-	}
-	return instances
-}
-
-
@@ -0,0 +1,273 @@
+// models/inventory_store.go
+package models
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kinds of inventory changes
+const (
+	InventoryAdded   = "added"
+	InventoryRemoved = "removed"
+	InventoryChanged = "changed"
+)
+
+// Number of inventory diffs kept for the changes page
+const inventoryDiffHistory = 100
+
+// InventoryRecord is an instance of the inventory and when it was first and last seen
+type InventoryRecord struct {
+	EC2Instance
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// InventoryChange is an instance that was added, removed or changed by an inventory load
+type InventoryChange struct {
+	Kind     string          `json:"kind"`
+	Instance InventoryRecord `json:"instance"`           // The instance after the load, or as last seen if removed
+	Previous *EC2Instance    `json:"previous,omitempty"` // The instance before the load, for changes
+	Fields   []string        `json:"fields,omitempty"`   // The fields that changed
+}
+
+// InventoryDiff is the difference between two inventory loads
+type InventoryDiff struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Source    string            `json:"source"`
+	Version   string            `json:"version"`
+	Changes   []InventoryChange `json:"changes"`
+}
+
+// Count returns the number of changes of the given kind
+func (d InventoryDiff) Count(kind string) int {
+	count := 0
+	for _, change := range d.Changes {
+		if change.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// inventoryField is an instance field compared between loads
+type inventoryField struct {
+	name  string
+	value func(EC2Instance) string
+}
+
+// trackedInventoryFields are the fields whose changes are reported; state and uptime
+// change all the time and are left out
+var trackedInventoryFields = []inventoryField{
+	{"owner", func(i EC2Instance) string { return i.Owner }},
+	{"service", func(i EC2Instance) string { return i.Service }},
+	{"name", func(i EC2Instance) string { return i.EC2Name }},
+	{"environment_class", func(i EC2Instance) string { return i.EnvironmentClass }},
+	{"aws_account_name", func(i EC2Instance) string { return i.AWSAccountName }},
+}
+
+// The inventory store holds the current snapshot of the inventory by instance ID
+var (
+	inventoryMutex   sync.RWMutex
+	inventoryRecords = make(map[string]InventoryRecord)
+	inventoryLoaded  bool
+	inventoryDiffs   []InventoryDiff // Newest first
+
+	inventorySubscribers     = make(map[chan InventoryDiff]struct{})
+	inventorySubscribersLock sync.Mutex
+)
+
+// LoadInstances replaces the inventory with a new snapshot and returns the difference to
+// the previous one. Readers see either the old or the new inventory, never a mix. The
+// first load is the baseline and reports no changes.
+func LoadInstances(instances []EC2Instance, source, version string) InventoryDiff {
+	now := time.Now()
+	diff := InventoryDiff{Timestamp: now, Source: source, Version: version}
+	records := make(map[string]InventoryRecord, len(instances))
+	restarts := recordedRestarts()
+
+	inventoryMutex.Lock()
+	for _, instance := range instances {
+		countUptimeFromRestart(&instance, restarts)
+		record := InventoryRecord{EC2Instance: instance, FirstSeen: now, LastSeen: now}
+		if previous, exists := inventoryRecords[instance.ID]; exists {
+			record.FirstSeen = previous.FirstSeen
+			if fields := changedFields(previous.EC2Instance, instance); len(fields) > 0 {
+				before := previous.EC2Instance
+				diff.Changes = append(diff.Changes, InventoryChange{Kind: InventoryChanged, Instance: record, Previous: &before, Fields: fields})
+			}
+		} else if inventoryLoaded {
+			diff.Changes = append(diff.Changes, InventoryChange{Kind: InventoryAdded, Instance: record})
+		}
+		records[instance.ID] = record
+	}
+	for instanceID, previous := range inventoryRecords {
+		if _, exists := records[instanceID]; !exists {
+			diff.Changes = append(diff.Changes, InventoryChange{Kind: InventoryRemoved, Instance: previous})
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		if diff.Changes[i].Kind != diff.Changes[j].Kind {
+			return diff.Changes[i].Kind < diff.Changes[j].Kind
+		}
+		return diff.Changes[i].Instance.ID < diff.Changes[j].Instance.ID
+	})
+
+	inventoryRecords = records
+	inventoryLoaded = true
+	if len(diff.Changes) > 0 {
+		inventoryDiffs = append([]InventoryDiff{diff}, inventoryDiffs...)
+		if len(inventoryDiffs) > inventoryDiffHistory {
+			inventoryDiffs = inventoryDiffs[:inventoryDiffHistory]
+		}
+	}
+	inventoryMutex.Unlock()
+
+	if len(diff.Changes) > 0 {
+		publishInventoryDiff(diff)
+	}
+	return diff
+}
+
+// MarkInventorySeen records that the source still lists every instance, e.g. when it
+// reported that it has not changed since the last load. Restarts since then still lower
+// the uptimes, so that the daily uptime snapshot sees them.
+func MarkInventorySeen() {
+	now := time.Now()
+	restarts := recordedRestarts()
+
+	inventoryMutex.Lock()
+	defer inventoryMutex.Unlock()
+	for instanceID, record := range inventoryRecords {
+		record.LastSeen = now
+		countUptimeFromRestart(&record.EC2Instance, restarts)
+		inventoryRecords[instanceID] = record
+	}
+}
+
+// recordedRestarts returns the last restart of each instance from the job history, or nil
+// if it cannot be read
+func recordedRestarts() map[string]time.Time {
+	if jobStore == nil {
+		return nil
+	}
+	restarts, err := LastRestarts()
+	if err != nil {
+		log.Printf("Error loading restarts for instance uptimes: %v", err)
+		return nil
+	}
+	return restarts
+}
+
+// countUptimeFromRestart lowers the uptime of an instance to the days since its last restart
+// by a job. Inventory sources count uptime from the launch time, which a reboot does not reset.
+func countUptimeFromRestart(instance *EC2Instance, restarts map[string]time.Time) {
+	restartedAt, restarted := restarts[instance.ID]
+	if !restarted {
+		return
+	}
+	days := int(time.Since(restartedAt).Hours() / 24)
+	if uptime, known := instance.Uptime(); known && uptime <= float64(days) {
+		return
+	}
+	instance.UptimeDays = strconv.Itoa(days)
+}
+
+// changedFields returns the names of the tracked fields that differ between two instances
+func changedFields(before, after EC2Instance) []string {
+	var fields []string
+	for _, field := range trackedInventoryFields {
+		if field.value(before) != field.value(after) {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
+// GetInstanceDetails retrieves the details of an EC2 instance by its ID
+func GetInstanceDetails(instanceID string) (*EC2Instance, error) {
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	record, exists := inventoryRecords[instanceID]
+	if !exists {
+		return nil, fmt.Errorf("instance ID %s not found", instanceID)
+	}
+	instance := record.EC2Instance
+	return &instance, nil
+}
+
+// GetInstances retrieves all EC2 instances of the current inventory, ordered by ID
+func GetInstances() []EC2Instance {
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	instances := make([]EC2Instance, 0, len(inventoryRecords))
+	for _, record := range inventoryRecords {
+		instances = append(instances, record.EC2Instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// GetInventoryRecords retrieves all instances of the current inventory with when they
+// were first and last seen, ordered by ID
+func GetInventoryRecords() []InventoryRecord {
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+
+	records := make([]InventoryRecord, 0, len(inventoryRecords))
+	for _, record := range inventoryRecords {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
+
+// ListInventoryDiffs returns the recent inventory diffs that had changes, newest first
+func ListInventoryDiffs() []InventoryDiff {
+	inventoryMutex.RLock()
+	defer inventoryMutex.RUnlock()
+	return append([]InventoryDiff(nil), inventoryDiffs...)
+}
+
+// SubscribeInventoryEvents registers a subscriber for inventory diffs with changes. The
+// returned function must be called to unsubscribe once the subscriber is done.
+func SubscribeInventoryEvents() (<-chan InventoryDiff, func()) {
+	events := make(chan InventoryDiff, 16)
+
+	inventorySubscribersLock.Lock()
+	inventorySubscribers[events] = struct{}{}
+	inventorySubscribersLock.Unlock()
+
+	unsubscribe := func() {
+		inventorySubscribersLock.Lock()
+		defer inventorySubscribersLock.Unlock()
+		if _, exists := inventorySubscribers[events]; exists {
+			delete(inventorySubscribers, events)
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+// publishInventoryDiff sends a diff to all subscribers. Slow subscribers miss diffs
+// rather than blocking inventory loads.
+func publishInventoryDiff(diff InventoryDiff) {
+	inventorySubscribersLock.Lock()
+	defer inventorySubscribersLock.Unlock()
+	for events := range inventorySubscribers {
+		select {
+		case events <- diff:
+		default:
+		}
+	}
+}
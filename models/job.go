@@ -0,0 +1,279 @@
+// models/job.go
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job types
+const (
+	JobTypeRestart    = "restart"
+	JobTypeStopStart  = "stop-start"
+	JobTypeRollout    = "rollout"
+	JobTypeCommand    = "command"
+	JobTypeAutomation = "automation"
+)
+
+// Job states
+const (
+	JobStateRunning     = "Running"
+	JobStateCompleted   = "Completed"
+	JobStateInterrupted = "Interrupted"
+)
+
+// Job types whose tasks restart instances
+var restartJobTypes = []string{JobTypeRestart, JobTypeStopStart, JobTypeRollout}
+
+const (
+	// Jobs listed on the status pages and by the API, newest first
+	jobHistoryLimit = 200
+	// Days jobs are kept for; the audit trail keeps their outcomes for longer
+	jobRetentionDays = 180
+)
+
+// Job is one user action over many instances
+type Job struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`        // e.g., "restart", "command"
+	User        string    `json:"user"`        // Display name of the user who started the job
+	Description string    `json:"description"` // e.g., the command name
+	State       string    `json:"state"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Tasks       []Task    `json:"tasks"`
+	Rollout     *Rollout  `json:"rollout,omitempty"` // Batches and their progress, for rollout jobs
+}
+
+// Task holds the result of a job on a single instance
+type Task struct {
+	InstanceID         string     `json:"instance_id"`
+	InstanceName       string     `json:"instance_name"`
+	AWSAccountName     string     `json:"aws_account_name"`
+	AWSAccountNumber   string     `json:"aws_account_number"`
+	Region             string     `json:"region"`
+	Status             string     `json:"status"`                            // e.g., "Rebooting", "Healthy", "Success"
+	Done               bool       `json:"done"`                              // Whether Status is final
+	Warning            string     `json:"warning,omitempty"`                 // Caveat about the operation, e.g. a public IP that will change
+	Command            string     `json:"command,omitempty"`                 // The command that was executed
+	CommandID          string     `json:"command_id,omitempty"`              // AWS SSM Command ID
+	Output             string     `json:"output,omitempty"`                  // Command output, truncated by SSM
+	Stderr             string     `json:"stderr,omitempty"`                  // Command standard error, truncated by SSM
+	ResponseCode       *int       `json:"response_code,omitempty"`           // Exit code of the command, once it has run
+	ExecutionStartedAt *time.Time `json:"execution_started_at,omitempty"`    // When the command started on the instance
+	ExecutionEndedAt   *time.Time `json:"execution_ended_at,omitempty"`      // When the command ended on the instance
+	OutputS3Bucket     string     `json:"output_s3_bucket,omitempty"`        // Bucket holding the full command output
+	OutputS3Prefix     string     `json:"output_s3_prefix,omitempty"`        // Key prefix of the instance's full output
+	CancelledBy        string     `json:"cancelled_by,omitempty"`            // User who cancelled the command
+	AutomationID       string     `json:"automation_execution_id,omitempty"` // AWS SSM Automation execution ID
+	Steps              []TaskStep `json:"steps,omitempty"`                   // Progress of each step of an Automation execution
+	RestartedAt        *time.Time `json:"restarted_at,omitempty"`            // When EC2 accepted the reboot or start of the instance
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TaskStep is the progress of one step of an Automation execution on an instance
+type TaskStep struct {
+	Name      string     `json:"name"`
+	Action    string     `json:"action"` // e.g. aws:changeInstanceState
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Message   string     `json:"message,omitempty"` // Why the step failed
+}
+
+// JobStore persists jobs so that history survives restarts
+type JobStore interface {
+	SaveJob(job *Job) error
+	GetJob(id string) (*Job, error)
+	// UpdateJob atomically applies change to the stored job
+	UpdateJob(id string, change func(*Job)) error
+	// ListJobs returns up to limit jobs of the given types, newest first; no types means all
+	// jobs and a limit of 0 means no limit
+	ListJobs(limit int, types ...string) ([]*Job, error)
+	// DeleteJobsBefore removes the jobs started before cutoff
+	DeleteJobsBefore(cutoff time.Time) error
+	// RecordRestart keeps the time an instance was restarted, unless a later one is recorded
+	RecordRestart(instanceID string, restartedAt time.Time) error
+	// LastRestarts returns when each instance was last restarted
+	LastRestarts() (map[string]time.Time, error)
+	Close() error
+}
+
+var jobStore JobStore
+
+// InjectJobStore injects the store used for jobs
+func InjectJobStore(store JobStore) {
+	jobStore = store
+}
+
+// NewJob creates and stores a job with a pending task for each instance
+func NewJob(jobType, user, description string, instanceIDs []string) (*Job, error) {
+	job := newJob(jobType, user, description, instanceIDs)
+	if err := saveNewJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// newJob returns a running job with a pending task for each instance
+func newJob(jobType, user, description string, instanceIDs []string) *Job {
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		User:        user,
+		Description: description,
+		State:       JobStateRunning,
+		StartedAt:   now,
+	}
+
+	for _, instanceID := range instanceIDs {
+		task := Task{
+			InstanceID: instanceID,
+			Status:     "Pending",
+			UpdatedAt:  now,
+		}
+		// Keep the instance details with the task in case it leaves the inventory
+		if instance, err := GetInstanceDetails(instanceID); err == nil {
+			task.InstanceName = instance.EC2Name
+			task.AWSAccountName = instance.AWSAccountName
+			task.AWSAccountNumber = instance.AWSAccountNumber
+			task.Region = instance.Region
+		}
+		job.Tasks = append(job.Tasks, task)
+	}
+	return job
+}
+
+// saveNewJob stores a new job and records the request of each task in the audit trail
+func saveNewJob(job *Job) error {
+	if err := jobStore.SaveJob(job); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	for _, task := range job.Tasks {
+		recordAudit(job, task, AuditOutcomeRequested)
+	}
+	return nil
+}
+
+// GetJob retrieves a job by its ID
+func GetJob(id string) (*Job, error) {
+	return jobStore.GetJob(id)
+}
+
+// ListJobs retrieves the most recent jobs of the given job types, newest first
+func ListJobs(types ...string) ([]*Job, error) {
+	return jobStore.ListJobs(jobHistoryLimit, types...)
+}
+
+// DeleteOldJobs drops jobs started before the retention period
+func DeleteOldJobs(now time.Time) error {
+	if jobStore == nil {
+		return nil
+	}
+	if err := jobStore.DeleteJobsBefore(now.AddDate(0, 0, -jobRetentionDays)); err != nil {
+		return fmt.Errorf("failed to delete old jobs: %w", err)
+	}
+	return nil
+}
+
+// UpdateTask applies a change to the task of an instance within a job. The job is
+// marked completed once all of its tasks are done, and the outcome of a task is
+// recorded in the audit trail when it becomes done. Restarts are also kept apart from the
+// job, so that instance uptimes do not need the whole job history.
+func UpdateTask(jobID, instanceID string, change func(*Task)) error {
+	var updatedJob Job
+	var changed, completed, restarted []Task
+	err := jobStore.UpdateJob(jobID, func(job *Job) {
+		defer func() { updatedJob = *job }()
+
+		for i := range job.Tasks {
+			if job.Tasks[i].InstanceID == instanceID {
+				wasDone, wasRestarted := job.Tasks[i].Done, job.Tasks[i].RestartedAt
+				change(&job.Tasks[i])
+				job.Tasks[i].UpdatedAt = time.Now()
+				changed = append(changed, job.Tasks[i])
+				if job.Tasks[i].Done && !wasDone {
+					completed = append(completed, job.Tasks[i])
+				}
+				if restartedAt := job.Tasks[i].RestartedAt; restartedAt != nil && (wasRestarted == nil || !restartedAt.Equal(*wasRestarted)) {
+					restarted = append(restarted, job.Tasks[i])
+				}
+			}
+		}
+
+		for _, task := range job.Tasks {
+			if !task.Done {
+				return
+			}
+		}
+		if job.State == JobStateRunning {
+			job.State = JobStateCompleted
+			job.EndedAt = time.Now()
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, task := range changed {
+		publishTaskEvent(&updatedJob, task)
+	}
+	for _, task := range completed {
+		recordAudit(&updatedJob, task, task.Status)
+	}
+	if containsString(restartJobTypes, updatedJob.Type) {
+		for _, task := range restarted {
+			if err := jobStore.RecordRestart(task.InstanceID, *task.RestartedAt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LastRestarts returns when each instance was last rebooted or started by a restart,
+// stop/start or rollout job
+func LastRestarts() (map[string]time.Time, error) {
+	return jobStore.LastRestarts()
+}
+
+// InterruptRunningJobs marks jobs that were still running when the application stopped,
+// since nothing will update their tasks anymore
+func InterruptRunningJobs() error {
+	jobs, err := jobStore.ListJobs(0)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.State != JobStateRunning {
+			continue
+		}
+		var interrupted []Task
+		err := jobStore.UpdateJob(job.ID, func(job *Job) {
+			job.State = JobStateInterrupted
+			job.EndedAt = time.Now()
+			for i := range job.Tasks {
+				if !job.Tasks[i].Done {
+					job.Tasks[i].Status = "Interrupted (" + job.Tasks[i].Status + ")"
+					job.Tasks[i].Done = true
+					interrupted = append(interrupted, job.Tasks[i])
+				}
+			}
+			if job.Rollout != nil {
+				job.Rollout.interrupt()
+			}
+		})
+		if err != nil {
+			return err
+		}
+		for _, task := range interrupted {
+			recordAudit(job, task, task.Status)
+		}
+	}
+	return nil
+}
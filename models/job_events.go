@@ -0,0 +1,55 @@
+// models/job_events.go
+package models
+
+import "sync"
+
+// TaskEvent describes a change to a task of a job
+type TaskEvent struct {
+	JobID    string `json:"job_id"`
+	JobState string `json:"job_state"`
+	Task     Task   `json:"task"`
+}
+
+var (
+	taskSubscribers     = make(map[chan TaskEvent]struct{})
+	taskSubscribersLock sync.Mutex
+)
+
+// SubscribeTaskEvents registers a subscriber for task changes. The returned function
+// must be called to unsubscribe once the subscriber is done. The channel is closed if the
+// subscriber falls behind.
+func SubscribeTaskEvents() (<-chan TaskEvent, func()) {
+	events := make(chan TaskEvent, 64)
+
+	taskSubscribersLock.Lock()
+	taskSubscribers[events] = struct{}{}
+	taskSubscribersLock.Unlock()
+
+	unsubscribe := func() {
+		taskSubscribersLock.Lock()
+		defer taskSubscribersLock.Unlock()
+		if _, exists := taskSubscribers[events]; exists {
+			delete(taskSubscribers, events)
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+// publishTaskEvent sends a task change to all subscribers. A subscriber that falls behind is
+// unsubscribed and its channel closed rather than blocking job updates, so that it starts
+// again from the current state of the jobs instead of silently missing changes.
+func publishTaskEvent(job *Job, task Task) {
+	event := TaskEvent{JobID: job.ID, JobState: job.State, Task: task}
+
+	taskSubscribersLock.Lock()
+	defer taskSubscribersLock.Unlock()
+	for events := range taskSubscribers {
+		select {
+		case events <- event:
+		default:
+			delete(taskSubscribers, events)
+			close(events)
+		}
+	}
+}
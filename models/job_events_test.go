@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestPublishTaskEventClosesLaggingSubscriber(t *testing.T) {
+	lagging, unsubscribeLagging := SubscribeTaskEvents()
+	defer unsubscribeLagging()
+	reading, unsubscribeReading := SubscribeTaskEvents()
+	defer unsubscribeReading()
+
+	job := &Job{ID: "job", State: JobStateRunning}
+	for i := 0; i < cap(lagging)+1; i++ {
+		publishTaskEvent(job, Task{InstanceID: "i-1"})
+		<-reading
+	}
+
+	received := 0
+	for range lagging {
+		received++
+	}
+	if received != cap(lagging) {
+		t.Errorf("lagging subscriber received %d events before its channel closed, want %d", received, cap(lagging))
+	}
+
+	// Subscribers that keep up still get every event
+	publishTaskEvent(job, Task{InstanceID: "i-2"})
+	if event, open := <-reading; !open || event.Task.InstanceID != "i-2" {
+		t.Errorf("reading subscriber got %+v, open %v", event, open)
+	}
+}
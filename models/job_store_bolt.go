@@ -0,0 +1,273 @@
+// models/job_store_bolt.go
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket = []byte("jobs")
+	// jobIndexBucket lists jobs by start time and ID, with the job type as value, so that the
+	// newest jobs of a type are found without reading the others
+	jobIndexBucket = []byte("jobs_by_start")
+	// lastRestartsBucket holds when each instance was last restarted by a job, by instance ID
+	lastRestartsBucket = []byte("last_restarts")
+)
+
+// BoltJobStore stores jobs as JSON documents in an embedded BoltDB file. The other stores
+// sharing the file create their buckets when they first write to them.
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+// NewBoltJobStore opens (or creates) the BoltDB file at path
+func NewBoltJobStore(path string) (*BoltJobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for job store: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store %s: %w", path, err)
+	}
+
+	store := &BoltJobStore{db: db}
+	if err := store.indexJobs(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to index job store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// SaveJob stores a job, replacing any job with the same ID
+func (s *BoltJobStore) SaveJob(job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJob(tx, job)
+	})
+}
+
+// GetJob retrieves a job by its ID
+func (s *BoltJobStore) GetJob(id string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getJob(tx, id)
+		return err
+	})
+	return job, err
+}
+
+// UpdateJob applies change to a job within a single transaction
+func (s *BoltJobStore) UpdateJob(id string, change func(*Job)) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		job, err := getJob(tx, id)
+		if err != nil {
+			return err
+		}
+		change(job)
+		return putJob(tx, job)
+	})
+}
+
+// ListJobs returns up to limit jobs of the given types, newest first; a limit of 0 returns
+// them all
+func (s *BoltJobStore) ListJobs(limit int, types ...string) ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(jobIndexBucket)
+		if index == nil {
+			return nil
+		}
+		cursor := index.Cursor()
+		for key, jobType := cursor.Last(); key != nil; key, jobType = cursor.Prev() {
+			if len(types) > 0 && !containsString(types, string(jobType)) {
+				continue
+			}
+			job, err := getJob(tx, string(key[8:]))
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			if limit > 0 && len(jobs) == limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// DeleteJobsBefore removes the jobs started before cutoff
+func (s *BoltJobStore) DeleteJobsBefore(cutoff time.Time) error {
+	var old [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if index := tx.Bucket(jobIndexBucket); index != nil {
+			end := jobIndexKey(&Job{StartedAt: cutoff})
+			cursor := index.Cursor()
+			for key, _ := cursor.First(); key != nil && bytes.Compare(key, end) < 0; key, _ = cursor.Next() {
+				old = append(old, append([]byte{}, key...))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(old) == 0 {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		index, jobs := tx.Bucket(jobIndexBucket), tx.Bucket(jobsBucket)
+		for _, key := range old {
+			if err := jobs.Delete(key[8:]); err != nil {
+				return err
+			}
+			if err := index.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordRestart keeps the time an instance was restarted, unless a later restart is recorded
+func (s *BoltJobStore) RecordRestart(instanceID string, restartedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putRestart(tx, instanceID, restartedAt)
+	})
+}
+
+// LastRestarts returns when each instance was last restarted
+func (s *BoltJobStore) LastRestarts() (map[string]time.Time, error) {
+	restarts := make(map[string]time.Time)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(lastRestartsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var restartedAt time.Time
+			if err := restartedAt.UnmarshalText(value); err != nil {
+				return fmt.Errorf("failed to unmarshal restart of %s: %w", key, err)
+			}
+			restarts[string(key)] = restartedAt
+			return nil
+		})
+	})
+	return restarts, err
+}
+
+// indexJobs builds the start time index and the last restarts of stores written before they
+// existed
+func (s *BoltJobStore) indexJobs() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		if jobs == nil || tx.Bucket(jobIndexBucket) != nil {
+			return nil
+		}
+		index, err := tx.CreateBucket(jobIndexBucket)
+		if err != nil {
+			return err
+		}
+		return jobs.ForEach(func(key, value []byte) error {
+			var job Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return fmt.Errorf("failed to unmarshal job %s: %w", key, err)
+			}
+			if err := index.Put(jobIndexKey(&job), []byte(job.Type)); err != nil {
+				return err
+			}
+			if !containsString(restartJobTypes, job.Type) {
+				return nil
+			}
+			for _, task := range job.Tasks {
+				if task.RestartedAt != nil {
+					if err := putRestart(tx, task.InstanceID, *task.RestartedAt); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Close closes the underlying BoltDB file
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
+
+func getJob(tx *bolt.Tx, id string) (*Job, error) {
+	var value []byte
+	if bucket := tx.Bucket(jobsBucket); bucket != nil {
+		value = bucket.Get([]byte(id))
+	}
+	if value == nil {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+
+	var job Job
+	if err := json.Unmarshal(value, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+func putJob(tx *bolt.Tx, job *Job) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+	bucket, err := tx.CreateBucketIfNotExists(jobsBucket)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put([]byte(job.ID), value); err != nil {
+		return err
+	}
+	index, err := tx.CreateBucketIfNotExists(jobIndexBucket)
+	if err != nil {
+		return err
+	}
+	return index.Put(jobIndexKey(job), []byte(job.Type))
+}
+
+// jobIndexKey is the start time of a job in nanoseconds, big-endian so that keys sort oldest
+// first, followed by the job ID
+func jobIndexKey(job *Job) []byte {
+	key := make([]byte, 8, 8+len(job.ID))
+	binary.BigEndian.PutUint64(key, uint64(job.StartedAt.UnixNano()))
+	return append(key, job.ID...)
+}
+
+func putRestart(tx *bolt.Tx, instanceID string, restartedAt time.Time) error {
+	bucket, err := tx.CreateBucketIfNotExists(lastRestartsBucket)
+	if err != nil {
+		return err
+	}
+	var recorded time.Time
+	if value := bucket.Get([]byte(instanceID)); value != nil && recorded.UnmarshalText(value) == nil && !restartedAt.After(recorded) {
+		return nil
+	}
+	value, err := restartedAt.MarshalText()
+	if err != nil {
+		return fmt.Errorf("failed to marshal restart of %s: %w", instanceID, err)
+	}
+	return bucket.Put([]byte(instanceID), value)
+}
+
+// containsString checks if a slice contains a string
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestJobStore(t *testing.T, path string) *BoltJobStore {
+	t.Helper()
+	store, err := NewBoltJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testJob returns a job started hours before start, with one task per instance
+func testJob(id, jobType string, start time.Time, hours int, instanceIDs ...string) *Job {
+	job := &Job{ID: id, Type: jobType, State: JobStateCompleted, StartedAt: start.Add(-time.Duration(hours) * time.Hour)}
+	for _, instanceID := range instanceIDs {
+		job.Tasks = append(job.Tasks, Task{InstanceID: instanceID, Done: true})
+	}
+	return job
+}
+
+func jobIDs(jobs []*Job) string {
+	var ids []string
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestBoltJobStoreListJobs(t *testing.T) {
+	store := openTestJobStore(t, filepath.Join(t.TempDir(), "jobs.db"))
+	now := time.Now()
+	for _, job := range []*Job{
+		testJob("a", JobTypeRestart, now, 5),
+		testJob("b", JobTypeCommand, now, 4),
+		testJob("c", JobTypeRestart, now, 3),
+		testJob("d", JobTypeRollout, now, 2),
+		testJob("e", JobTypeCommand, now, 1),
+	} {
+		if err := store.SaveJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Updates must not add jobs to the index twice
+	if err := store.UpdateJob("c", func(job *Job) { job.State = JobStateInterrupted }); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		types []string
+		want  string
+	}{
+		{"all", 0, nil, "e,d,c,b,a"},
+		{"newest", 2, nil, "e,d"},
+		{"limit above count", 10, nil, "e,d,c,b,a"},
+		{"type", 0, []string{JobTypeRestart}, "c,a"},
+		{"newest of type", 1, []string{JobTypeRestart}, "c"},
+		{"types", 2, []string{JobTypeRestart, JobTypeRollout}, "d,c"},
+		{"no jobs of type", 0, []string{JobTypeAutomation}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobs, err := store.ListJobs(test.limit, test.types...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := jobIDs(jobs); got != test.want {
+				t.Errorf("listed %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if err := store.DeleteJobsBefore(now.Add(-150 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := store.ListJobs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(jobs); got != "e,d" {
+		t.Errorf("kept %q, want e,d", got)
+	}
+	if _, err := store.GetJob("a"); err == nil {
+		t.Error("deleted job can still be read")
+	}
+}
+
+func TestLastRestarts(t *testing.T) {
+	store := openTestJobStore(t, filepath.Join(t.TempDir(), "jobs.db"))
+	InjectJobStore(store)
+	defer InjectJobStore(nil)
+
+	now := time.Now().Truncate(time.Second)
+	restart := testJob("restart", JobTypeRestart, now, 2, "i-1", "i-2")
+	command := testJob("command", JobTypeCommand, now, 1, "i-2")
+	for _, job := range []*Job{restart, command} {
+		if err := store.SaveJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restartAt := func(at time.Time) func(*Task) {
+		return func(task *Task) { task.RestartedAt = &at }
+	}
+	if err := UpdateTask("restart", "i-1", restartAt(now.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateTask("restart", "i-2", restartAt(now.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	// An earlier restart does not replace a later one, and other jobs do not count
+	if err := UpdateTask("restart", "i-1", restartAt(now.Add(-2*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateTask("command", "i-2", restartAt(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restarts outlive the jobs that made them
+	if err := store.DeleteJobsBefore(now); err != nil {
+		t.Fatal(err)
+	}
+	restarts, err := LastRestarts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restarts) != 2 || !restarts["i-1"].Equal(now.Add(-time.Hour)) || !restarts["i-2"].Equal(now.Add(-time.Hour)) {
+		t.Errorf("restarts %v, want i-1 and i-2 an hour ago", restarts)
+	}
+}
+
+func TestBoltJobStoreIndexesOlderFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	now := time.Now().Truncate(time.Second)
+	restartedAt := now.Add(-time.Hour)
+	older := testJob("older", JobTypeStopStart, now, 2, "i-1")
+	older.Tasks[0].RestartedAt = &restartedAt
+	newer := testJob("newer", JobTypeCommand, now, 1, "i-1")
+
+	// Write the jobs the way stores without an index did
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(jobsBucket)
+		if err != nil {
+			return err
+		}
+		for _, job := range []*Job{older, newer} {
+			value, _ := json.Marshal(job)
+			if err := bucket.Put([]byte(job.ID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := openTestJobStore(t, path)
+	jobs, err := store.ListJobs(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jobIDs(jobs); got != "newer,older" {
+		t.Errorf("listed %q, want newer,older", got)
+	}
+	restarts, err := store.LastRestarts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restarts) != 1 || !restarts["i-1"].Equal(restartedAt) {
+		t.Errorf("restarts %v, want i-1 at %v", restarts, restartedAt)
+	}
+}
@@ -0,0 +1,162 @@
+// models/policy.go
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Actions that roles, API keys and service principals can be allowed to perform
+const (
+	ActionRead     = "read"     // See instances, jobs, the audit trail and the schedule
+	ActionRestart  = "restart"  // Restart, stop/start and rolling restart instances
+	ActionCommand  = "command"  // Run commands on instances
+	ActionSchedule = "schedule" // Update the patching schedule
+)
+
+// AllActions lists every action
+var AllActions = []string{ActionRead, ActionRestart, ActionCommand, ActionSchedule}
+
+// Role every user gets when no groups are mapped to roles, matching the single group check
+// that came before role-based access control
+const RoleAdmin = "admin"
+
+// Grant allows actions on the instances matching all of its non-empty filters
+type Grant struct {
+	Role               string
+	Actions            []string
+	AccountNames       []string
+	EnvironmentClasses []string
+	Services           []string
+	Owners             []string
+}
+
+// Allows checks if the grant allows action on at least some instances
+func (g Grant) Allows(action string) bool {
+	return containsString(g.Actions, action)
+}
+
+// AllowsOn checks if the grant allows action on instance
+func (g Grant) AllowsOn(action string, instance EC2Instance) bool {
+	return g.Allows(action) && g.Covers(instance)
+}
+
+// Covers checks if instance matches the filters of the grant, whatever its actions
+func (g Grant) Covers(instance EC2Instance) bool {
+	return matchesFilter(g.AccountNames, instance.AWSAccountName) &&
+		matchesFilter(g.EnvironmentClasses, instance.EnvironmentClass) &&
+		matchesFilter(g.Services, instance.Service) &&
+		matchesFilter(g.Owners, instance.Owner)
+}
+
+// Includes checks if every instance the filters of other match is also matched by the
+// filters of g, whatever their actions
+func (g Grant) Includes(other Grant) bool {
+	return filterIncludes(g.AccountNames, other.AccountNames) &&
+		filterIncludes(g.EnvironmentClasses, other.EnvironmentClasses) &&
+		filterIncludes(g.Services, other.Services) &&
+		filterIncludes(g.Owners, other.Owners)
+}
+
+// filterIncludes checks if filter matches every value inner matches
+func filterIncludes(filter, inner []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	if len(inner) == 0 {
+		return false
+	}
+	for _, value := range inner {
+		if !containsString(filter, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesFilter checks if value is in filter; an empty filter matches everything
+func matchesFilter(filter []string, value string) bool {
+	return len(filter) == 0 || containsString(filter, value)
+}
+
+// DefaultRoles are the built-in roles; the configuration can override them or add more
+var DefaultRoles = map[string]Grant{
+	RoleAdmin:        {Actions: AllActions},
+	"viewer":         {Actions: []string{ActionRead}},
+	"dev-operator":   {Actions: []string{ActionRead, ActionRestart}, EnvironmentClasses: []string{"dev", "stg"}},
+	"prod-operator":  {Actions: []string{ActionRead, ActionRestart}, EnvironmentClasses: []string{"prod"}},
+	"command-runner": {Actions: []string{ActionRead, ActionCommand}},
+	"schedule-admin": {Actions: []string{ActionRead, ActionSchedule}},
+}
+
+// Policy maps Azure AD groups to roles
+type Policy struct {
+	roles  map[string]Grant
+	groups map[string][]string // Group ID to role names
+}
+
+// NewPolicy builds a policy from the built-in roles, the configured roles and the
+// group to role mapping, checking that every action and role it names exists
+func NewPolicy(roles map[string]Grant, groups map[string][]string) (*Policy, error) {
+	policy := &Policy{roles: make(map[string]Grant), groups: groups}
+	for name, grant := range DefaultRoles {
+		grant.Role = name
+		policy.roles[name] = grant
+	}
+	for name, grant := range roles {
+		for _, action := range grant.Actions {
+			if !containsString(AllActions, action) {
+				return nil, fmt.Errorf("role %s has unknown action %q", name, action)
+			}
+		}
+		grant.Role = name
+		policy.roles[name] = grant
+	}
+
+	for groupID, roleNames := range groups {
+		for _, name := range roleNames {
+			if _, exists := policy.roles[name]; !exists {
+				return nil, fmt.Errorf("group %s is mapped to unknown role %q", groupID, name)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// AnonymousGrants returns the roles of users who are not logged in. They can see every
+// instance until groups are mapped to roles.
+func (p *Policy) AnonymousGrants() []Grant {
+	if len(p.groups) == 0 {
+		return []Grant{p.roles["viewer"]}
+	}
+	return nil
+}
+
+// Role returns the role with the given name
+func (p *Policy) Role(name string) (Grant, bool) {
+	grant, exists := p.roles[name]
+	return grant, exists
+}
+
+// GrantsForGroups returns the roles of a member of the given groups. Without any group
+// mapping every user is an admin.
+func (p *Policy) GrantsForGroups(groupIDs []string) []Grant {
+	if len(p.groups) == 0 {
+		return []Grant{p.roles[RoleAdmin]}
+	}
+
+	seen := make(map[string]bool)
+	var grants []Grant
+	for _, groupID := range groupIDs {
+		for _, name := range p.groups[groupID] {
+			if !seen[name] {
+				seen[name] = true
+				grants = append(grants, p.roles[name])
+			}
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].Role < grants[j].Role
+	})
+	return grants
+}
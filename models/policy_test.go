@@ -0,0 +1,166 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// policyTestInstance is the instance grants are checked against, unless a test changes it
+var policyTestInstance = EC2Instance{
+	ID: "i-1", AWSAccountName: "payments-prod", EnvironmentClass: "prod", Service: "checkout", Owner: "team-a",
+}
+
+func TestGrantCovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		grant Grant
+		want  bool
+	}{
+		{"no filters", Grant{}, true},
+		{"account", Grant{AccountNames: []string{"payments-prod"}}, true},
+		{"other account", Grant{AccountNames: []string{"payments-dev"}}, false},
+		{"one of several accounts", Grant{AccountNames: []string{"payments-dev", "payments-prod"}}, true},
+		{"environment", Grant{EnvironmentClasses: []string{"prod"}}, true},
+		{"other environment", Grant{EnvironmentClasses: []string{"dev", "stg"}}, false},
+		{"environment is case-sensitive", Grant{EnvironmentClasses: []string{"PROD"}}, false},
+		{"service", Grant{Services: []string{"checkout"}}, true},
+		{"other service", Grant{Services: []string{"search"}}, false},
+		{"owner", Grant{Owners: []string{"team-a"}}, true},
+		{"other owner", Grant{Owners: []string{"team-b"}}, false},
+		{"every filter matches", Grant{
+			AccountNames: []string{"payments-prod"}, EnvironmentClasses: []string{"prod"},
+			Services: []string{"checkout"}, Owners: []string{"team-a"},
+		}, true},
+		{"all filters must match", Grant{
+			AccountNames: []string{"payments-prod"}, EnvironmentClasses: []string{"prod"},
+			Services: []string{"checkout"}, Owners: []string{"team-b"},
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.grant.Covers(policyTestInstance); got != test.want {
+				t.Errorf("Covers() = %v, want %v", got, test.want)
+			}
+			// AllowsOn needs both the action and the filters
+			test.grant.Actions = []string{ActionRestart}
+			if got := test.grant.AllowsOn(ActionRestart, policyTestInstance); got != test.want {
+				t.Errorf("AllowsOn(restart) = %v, want %v", got, test.want)
+			}
+			if test.grant.AllowsOn(ActionCommand, policyTestInstance) {
+				t.Error("AllowsOn(command) allowed an action the grant lacks")
+			}
+		})
+	}
+}
+
+func TestGrantCoversInstanceWithoutFields(t *testing.T) {
+	// Instances that left the inventory are checked with only their account name
+	instance := EC2Instance{ID: "i-gone", AWSAccountName: "payments-prod"}
+	if !(Grant{AccountNames: []string{"payments-prod"}}).Covers(instance) {
+		t.Error("account grant does not cover the instance")
+	}
+	if (Grant{EnvironmentClasses: []string{"prod"}}).Covers(instance) {
+		t.Error("environment grant covers an instance without an environment")
+	}
+}
+
+func TestGrantIncludes(t *testing.T) {
+	tests := []struct {
+		name         string
+		outer, inner Grant
+		want         bool
+	}{
+		{"unrestricted includes everything", Grant{}, Grant{EnvironmentClasses: []string{"prod"}}, true},
+		{"unrestricted includes unrestricted", Grant{}, Grant{}, true},
+		{"restricted does not include unrestricted", Grant{EnvironmentClasses: []string{"dev"}}, Grant{}, false},
+		{"same filter", Grant{EnvironmentClasses: []string{"dev"}}, Grant{EnvironmentClasses: []string{"dev"}}, true},
+		{"subset", Grant{EnvironmentClasses: []string{"dev", "stg"}}, Grant{EnvironmentClasses: []string{"stg"}}, true},
+		{"superset", Grant{EnvironmentClasses: []string{"dev"}}, Grant{EnvironmentClasses: []string{"dev", "prod"}}, false},
+		{"narrower on another field", Grant{EnvironmentClasses: []string{"dev"}}, Grant{EnvironmentClasses: []string{"dev"}, Owners: []string{"team-a"}}, true},
+		{"wider on another field", Grant{EnvironmentClasses: []string{"dev"}, Owners: []string{"team-a"}}, Grant{EnvironmentClasses: []string{"dev"}}, false},
+		{"account", Grant{AccountNames: []string{"a"}}, Grant{AccountNames: []string{"b"}}, false},
+		{"service", Grant{Services: []string{"a", "b"}}, Grant{Services: []string{"b"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.outer.Includes(test.inner); got != test.want {
+				t.Errorf("Includes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyWithoutGroupMapping(t *testing.T) {
+	policy, err := NewPolicy(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants := policy.GrantsForGroups(nil)
+	if len(grants) != 1 || grants[0].Role != RoleAdmin {
+		t.Fatalf("users get %+v, want the admin role", grants)
+	}
+	for _, action := range AllActions {
+		if !grants[0].AllowsOn(action, policyTestInstance) {
+			t.Errorf("admin may not %s", action)
+		}
+	}
+	anonymous := policy.AnonymousGrants()
+	if len(anonymous) != 1 || anonymous[0].Allows(ActionRestart) || !anonymous[0].AllowsOn(ActionRead, policyTestInstance) {
+		t.Errorf("anonymous users get %+v, want read only", anonymous)
+	}
+}
+
+func TestPolicyWithGroupMapping(t *testing.T) {
+	roles := map[string]Grant{
+		"checkout-operator": {Actions: []string{ActionRead, ActionRestart}, Services: []string{"checkout"}},
+	}
+	groups := map[string][]string{
+		"group-dev":      {"dev-operator"},
+		"group-checkout": {"checkout-operator", "viewer"},
+		"group-both":     {"dev-operator", "viewer"},
+	}
+	policy, err := NewPolicy(roles, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous := policy.AnonymousGrants(); len(anonymous) != 0 {
+		t.Errorf("anonymous users get %+v once groups are mapped", anonymous)
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		roles  string
+	}{
+		{"no groups", nil, ""},
+		{"unmapped group", []string{"group-other"}, ""},
+		{"one role", []string{"group-dev"}, "dev-operator"},
+		{"configured role", []string{"group-checkout"}, "checkout-operator,viewer"},
+		{"roles are not repeated", []string{"group-dev", "group-both"}, "dev-operator,viewer"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var names []string
+			for _, grant := range policy.GrantsForGroups(test.groups) {
+				names = append(names, grant.Role)
+			}
+			if got := strings.Join(names, ","); got != test.roles {
+				t.Errorf("roles %q, want %q", got, test.roles)
+			}
+		})
+	}
+
+	checkout, _ := policy.Role("checkout-operator")
+	if !checkout.AllowsOn(ActionRestart, policyTestInstance) || checkout.AllowsOn(ActionRestart, EC2Instance{Service: "search"}) {
+		t.Error("configured role does not restrict restarts to its service")
+	}
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	if _, err := NewPolicy(map[string]Grant{"bad": {Actions: []string{"delete"}}}, nil); err == nil || !strings.Contains(err.Error(), "unknown action") {
+		t.Errorf("got %v, want an unknown action error", err)
+	}
+	if _, err := NewPolicy(nil, map[string][]string{"group": {"missing"}}); err == nil || !strings.Contains(err.Error(), "unknown role") {
+		t.Errorf("got %v, want an unknown role error", err)
+	}
+}
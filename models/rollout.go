@@ -0,0 +1,154 @@
+// models/rollout.go
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// States of a rollout and of its batches
+const (
+	RolloutPending     = "Pending"
+	RolloutRunning     = "Running"
+	RolloutPausing     = "Pausing"
+	RolloutSucceeded   = "Succeeded"
+	RolloutFailed      = "Failed"
+	RolloutAborted     = "Aborted"
+	RolloutSkipped     = "Skipped"
+	RolloutInterrupted = "Interrupted"
+)
+
+// RolloutSettings controls how a rolling restart is split into batches
+type RolloutSettings struct {
+	BatchSize    int           `json:"batch_size"`    // Number of instances restarted at a time
+	BatchPercent int           `json:"batch_percent"` // Batch size as a percentage of all instances, overrides BatchSize when set
+	Pause        time.Duration `json:"pause"`         // Wait between a healthy batch and the next one
+	MaxFailures  int           `json:"max_failures"`  // Number of failed instances tolerated before the rollout is aborted
+}
+
+// RolloutBatch is a group of instances restarted together
+type RolloutBatch struct {
+	Number      int      `json:"number"`
+	InstanceIDs []string `json:"instance_ids"`
+	State       string   `json:"state"`
+	Failures    int      `json:"failures"`
+	StartedAt   string   `json:"started_at,omitempty"`  // ISO 8601 format timestamp
+	FinishedAt  string   `json:"finished_at,omitempty"` // ISO 8601 format timestamp
+}
+
+// Rollout is a rolling restart of many instances in batches. It is stored with its job,
+// which holds the per-instance results.
+type Rollout struct {
+	JobID     string          `json:"-"` // Set when the rollout is read from its job
+	Settings  RolloutSettings `json:"settings"`
+	State     string          `json:"state"`
+	Failures  int             `json:"failures"`
+	Batches   []RolloutBatch  `json:"batches"`
+	CreatedAt string          `json:"created_at"` // ISO 8601 format timestamp
+}
+
+// NewRolloutJob creates and stores a rollout job restarting the instances in batches, one batch
+// after the other
+func NewRolloutJob(user string, instanceIDs []string, settings RolloutSettings) (*Job, error) {
+	rollout := &Rollout{
+		Settings:  settings,
+		State:     RolloutPending,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	for i, batch := range splitBatches(instanceIDs, settings) {
+		rollout.Batches = append(rollout.Batches, RolloutBatch{
+			Number:      i + 1,
+			InstanceIDs: batch,
+			State:       RolloutPending,
+		})
+	}
+
+	job := newJob(JobTypeRollout, user, "Rolling restart", instanceIDs)
+	job.Rollout = rollout
+	if err := saveNewJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// splitBatches divides the instance IDs into batches according to the settings
+func splitBatches(instanceIDs []string, settings RolloutSettings) [][]string {
+	size := settings.BatchSize
+	if settings.BatchPercent > 0 {
+		// Round up so that a small percentage still restarts at least one instance
+		size = (len(instanceIDs)*settings.BatchPercent + 99) / 100
+	}
+	if size < 1 {
+		size = 1
+	}
+
+	var batches [][]string
+	for start := 0; start < len(instanceIDs); start += size {
+		end := start + size
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		batches = append(batches, instanceIDs[start:end])
+	}
+	return batches
+}
+
+// FinishBatch records the failures of a batch once its instances are restarted. The rollout
+// is aborted, skipping the remaining batches, once more than MaxFailures instances have
+// failed; FinishBatch returns whether it was.
+func (r *Rollout) FinishBatch(index, failures int) bool {
+	batch := &r.Batches[index]
+	batch.Failures = failures
+	batch.FinishedAt = time.Now().Format(time.RFC3339)
+	batch.State = RolloutSucceeded
+	if failures > 0 {
+		batch.State = RolloutFailed
+	}
+
+	r.Failures += failures
+	if r.Failures <= r.Settings.MaxFailures {
+		return false
+	}
+	r.State = RolloutAborted
+	for i := index + 1; i < len(r.Batches); i++ {
+		r.Batches[i].State = RolloutSkipped
+	}
+	return true
+}
+
+// GetRollout retrieves the rollout of a job
+func GetRollout(jobID string) (*Rollout, error) {
+	job, err := GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Rollout == nil {
+		return nil, fmt.Errorf("job %s is not a rollout", jobID)
+	}
+	job.Rollout.JobID = job.ID
+	return job.Rollout, nil
+}
+
+// UpdateRollout atomically applies change to the rollout of a job
+func UpdateRollout(jobID string, change func(*Rollout)) error {
+	return jobStore.UpdateJob(jobID, func(job *Job) {
+		if job.Rollout != nil {
+			change(job.Rollout)
+		}
+	})
+}
+
+// interrupt marks a rollout that was still going when the application stopped, since
+// nothing will restart its remaining batches anymore
+func (r *Rollout) interrupt() {
+	switch r.State {
+	case RolloutSucceeded, RolloutFailed, RolloutAborted:
+		return
+	}
+	r.State = RolloutInterrupted
+	for i := range r.Batches {
+		if r.Batches[i].State == RolloutPending || r.Batches[i].State == RolloutRunning {
+			r.Batches[i].State = RolloutInterrupted
+		}
+	}
+}
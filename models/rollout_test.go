@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testInstanceIDs returns n instance IDs, i-1 to i-n
+func testInstanceIDs(n int) []string {
+	var ids []string
+	for i := 1; i <= n; i++ {
+		ids = append(ids, fmt.Sprintf("i-%d", i))
+	}
+	return ids
+}
+
+// batchSizes describes batches by their sizes, e.g. "3,3,1"
+func batchSizes(batches [][]string) string {
+	var sizes []string
+	for _, batch := range batches {
+		sizes = append(sizes, fmt.Sprint(len(batch)))
+	}
+	return strings.Join(sizes, ",")
+}
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances int
+		settings  RolloutSettings
+		want      string
+	}{
+		{"size", 7, RolloutSettings{BatchSize: 3}, "3,3,1"},
+		{"size divides evenly", 6, RolloutSettings{BatchSize: 3}, "3,3"},
+		{"size larger than fleet", 2, RolloutSettings{BatchSize: 10}, "2"},
+		{"size equal to fleet", 4, RolloutSettings{BatchSize: 4}, "4"},
+		{"no size restarts one at a time", 3, RolloutSettings{}, "1,1,1"},
+		{"negative size restarts one at a time", 2, RolloutSettings{BatchSize: -5}, "1,1"},
+		{"percent", 10, RolloutSettings{BatchPercent: 50}, "5,5"},
+		{"percent rounds up", 7, RolloutSettings{BatchPercent: 50}, "4,3"},
+		{"small percent is one instance", 7, RolloutSettings{BatchPercent: 1}, "1,1,1,1,1,1,1"},
+		{"percent just over a batch", 10, RolloutSettings{BatchPercent: 21}, "3,3,3,1"},
+		{"whole fleet", 5, RolloutSettings{BatchPercent: 100}, "5"},
+		{"percent overrides size", 10, RolloutSettings{BatchSize: 2, BatchPercent: 40}, "4,4,2"},
+		{"one instance", 1, RolloutSettings{BatchPercent: 10}, "1"},
+		{"no instances", 0, RolloutSettings{BatchSize: 3}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ids := testInstanceIDs(test.instances)
+			batches := splitBatches(ids, test.settings)
+			if got := batchSizes(batches); got != test.want {
+				t.Errorf("batch sizes %q, want %q", got, test.want)
+			}
+
+			// Every instance is restarted once, in order
+			var all []string
+			for _, batch := range batches {
+				all = append(all, batch...)
+			}
+			if strings.Join(all, ",") != strings.Join(ids, ",") {
+				t.Errorf("batches %v do not hold the instances in order", batches)
+			}
+		})
+	}
+}
+
+func TestRolloutFinishBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures int
+		failures    []int // Failures of each batch finished, in turn
+		wantAborted bool
+		wantStates  string
+	}{
+		{"no failures", 0, []int{0, 0, 0}, false, "Succeeded,Succeeded,Succeeded"},
+		{"none tolerated, one failure", 0, []int{1}, true, "Failed,Skipped,Skipped"},
+		{"one tolerated, one failure", 1, []int{1, 0, 0}, false, "Failed,Succeeded,Succeeded"},
+		{"one tolerated, two failures in one batch", 1, []int{2}, true, "Failed,Skipped,Skipped"},
+		{"one tolerated, failures add up", 1, []int{1, 1}, true, "Failed,Failed,Skipped"},
+		{"failures in the last batch", 0, []int{0, 0, 1}, true, "Succeeded,Succeeded,Failed"},
+		{"at the limit", 2, []int{1, 0, 1}, false, "Failed,Succeeded,Failed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rollout := &Rollout{Settings: RolloutSettings{MaxFailures: test.maxFailures}, State: RolloutRunning}
+			for i := 1; i <= 3; i++ {
+				rollout.Batches = append(rollout.Batches, RolloutBatch{Number: i, State: RolloutPending})
+			}
+
+			aborted := false
+			for i, failures := range test.failures {
+				if aborted {
+					t.Fatalf("batch %d ran after the rollout was aborted", i+1)
+				}
+				aborted = rollout.FinishBatch(i, failures)
+			}
+			if aborted != test.wantAborted {
+				t.Errorf("aborted %v, want %v", aborted, test.wantAborted)
+			}
+			if aborted && rollout.State != RolloutAborted {
+				t.Errorf("rollout state %s, want %s", rollout.State, RolloutAborted)
+			}
+			var states []string
+			for _, batch := range rollout.Batches {
+				states = append(states, batch.State)
+			}
+			if got := strings.Join(states, ","); got != test.wantStates {
+				t.Errorf("batch states %s, want %s", got, test.wantStates)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// models/saved_view.go
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes of a saved view
+const (
+	ViewScopePrivate = "private" // Only the owner sees the view
+	ViewScopeTeam    = "team"    // Every user sees the view
+)
+
+// SavedView is a named instance filter. The filter is evaluated whenever the view is used,
+// so instances launched after the view was saved are included.
+type SavedView struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scope     string    `json:"scope"`
+	Filter    string    `json:"filter"`   // Encoded query parameters, as on the index page
+	OwnerID   string    `json:"owner_id"` // ID of the owner, see auth.GetUserID
+	Owner     string    `json:"owner"`    // Display name of the owner
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OwnedBy checks if the user with the given ID owns the view. Display names are not unique
+// and may change, so ownership is decided by ID only.
+func (v *SavedView) OwnedBy(userID string) bool {
+	return userID != "" && v.OwnerID == userID
+}
+
+// VisibleTo checks if the user with the given ID may see and use the view
+func (v *SavedView) VisibleTo(userID string) bool {
+	return v.Scope == ViewScopeTeam || v.OwnedBy(userID)
+}
+
+// ViewStore persists saved views
+type ViewStore interface {
+	SaveView(view *SavedView) error
+	GetView(id string) (*SavedView, error)
+	DeleteView(id string) error
+	// ListViews returns all views of every user
+	ListViews() ([]*SavedView, error)
+}
+
+var viewStore ViewStore
+
+// InjectViewStore injects the store used for saved views
+func InjectViewStore(store ViewStore) {
+	viewStore = store
+}
+
+// CreateView saves filter as a new view of the user with the given ID and display name.
+// Names are unique among the views the owner sees.
+func CreateView(name, scope, filter, ownerID, owner string) (*SavedView, error) {
+	if viewStore == nil {
+		return nil, fmt.Errorf("view store not initialized")
+	}
+	if ownerID == "" {
+		return nil, fmt.Errorf("views can only be saved by an identified user")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("view name is required")
+	}
+	if scope != ViewScopePrivate && scope != ViewScopeTeam {
+		return nil, fmt.Errorf("unknown view scope %q, expected %s or %s", scope, ViewScopePrivate, ViewScopeTeam)
+	}
+	if filter == "" {
+		return nil, fmt.Errorf("a view needs at least one filter")
+	}
+
+	views, err := ListViews(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		if strings.EqualFold(view.Name, name) {
+			return nil, fmt.Errorf("a view named %q already exists", view.Name)
+		}
+	}
+
+	view := &SavedView{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Scope:     scope,
+		Filter:    filter,
+		OwnerID:   ownerID,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+	}
+	if err := viewStore.SaveView(view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// ListViews returns the views the user with the given ID sees, their own private views first,
+// each sorted by name
+func ListViews(userID string) ([]*SavedView, error) {
+	if viewStore == nil {
+		return nil, nil
+	}
+	views, err := viewStore.ListViews()
+	if err != nil {
+		return nil, err
+	}
+
+	var private, team []*SavedView
+	for _, view := range views {
+		switch {
+		case view.Scope == ViewScopeTeam:
+			team = append(team, view)
+		case view.OwnedBy(userID):
+			private = append(private, view)
+		}
+	}
+	for _, list := range [][]*SavedView{private, team} {
+		sortViewsByName(list)
+	}
+	return append(private, team...), nil
+}
+
+// FindView returns the view the user with the given ID sees with the given view ID or,
+// failing that, name
+func FindView(ref, userID string) (*SavedView, error) {
+	views, err := ListViews(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, view := range views {
+		if view.ID == ref {
+			return view, nil
+		}
+	}
+	for _, view := range views {
+		if strings.EqualFold(view.Name, ref) {
+			return view, nil
+		}
+	}
+	return nil, fmt.Errorf("view %q not found", ref)
+}
+
+// DeleteView deletes a view. Only its owner, or an admin, may delete it.
+func DeleteView(id, userID string, isAdmin bool) error {
+	if viewStore == nil {
+		return fmt.Errorf("view store not initialized")
+	}
+	view, err := viewStore.GetView(id)
+	if err != nil {
+		return err
+	}
+	if !view.VisibleTo(userID) || (!view.OwnedBy(userID) && !isAdmin) {
+		return fmt.Errorf("not allowed to delete view %q", view.Name)
+	}
+	return viewStore.DeleteView(id)
+}
+
+// sortViewsByName sorts views by name, ignoring case
+func sortViewsByName(views []*SavedView) {
+	sort.Slice(views, func(i, j int) bool {
+		return strings.ToLower(views[i].Name) < strings.ToLower(views[j].Name)
+	})
+}
@@ -0,0 +1,157 @@
+// models/ssm_document.go
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types of SSM documents
+const (
+	DocumentTypeCommand    = "command"
+	DocumentTypeAutomation = "automation"
+)
+
+// SSMDocument is an SSM document operators may run on instances. Command documents run on
+// the instances through Run Command; Automation documents are started once per instance, with
+// the instance ID as their target parameter.
+type SSMDocument struct {
+	Name            string   `json:"name"`
+	Description     string   `json:"description,omitempty"`
+	Type            string   `json:"type"`
+	TargetParameter string   `json:"target_parameter,omitempty"` // Automation parameter set to the instance ID
+	Action          string   `json:"action"`                     // Action the caller needs on every instance
+	Parameters      []string `json:"parameters"`                 // Parameters the caller may set; all others keep the document's defaults
+}
+
+// automationAssumeRoleParameter is the Automation parameter naming the IAM role an execution
+// runs as. Automations always run as the command role, so it can never be set.
+const automationAssumeRoleParameter = "AutomationAssumeRole"
+
+// DefaultSSMDocuments are the built-in documents; the configuration can override them or add more
+var DefaultSSMDocuments = []SSMDocument{
+	{Name: "AWS-RunPatchBaseline", Description: "Scan for or install patches of the patch baseline", Type: DocumentTypeCommand, Action: ActionCommand,
+		Parameters: []string{"Operation", "RebootOption"}},
+	{Name: "AWS-ConfigureAWSPackage", Description: "Install or uninstall a Distributor package", Type: DocumentTypeCommand, Action: ActionCommand,
+		Parameters: []string{"action", "installationType", "name", "version"}},
+	{Name: "AWS-RestartEC2Instance", Description: "Stop and start the instance", Type: DocumentTypeAutomation, TargetParameter: "InstanceId", Action: ActionRestart},
+}
+
+var ssmDocuments = make(map[string]SSMDocument)
+
+// InjectSSMDocuments sets the documents operators may run, in addition to the built-in ones
+func InjectSSMDocuments(configured []SSMDocument) error {
+	documents := make(map[string]SSMDocument)
+	for _, document := range append(append([]SSMDocument{}, DefaultSSMDocuments...), configured...) {
+		if document.Name == "" {
+			return fmt.Errorf("SSM document without a name")
+		}
+		switch document.Type {
+		case "":
+			document.Type = DocumentTypeCommand
+		case DocumentTypeCommand:
+		case DocumentTypeAutomation:
+			if document.TargetParameter == "" {
+				document.TargetParameter = "InstanceId"
+			}
+		default:
+			return fmt.Errorf("SSM document %s has unknown type %q", document.Name, document.Type)
+		}
+		if document.Type == DocumentTypeCommand {
+			document.TargetParameter = ""
+		}
+		if document.Action == "" {
+			document.Action = ActionCommand
+		} else if !containsString(AllActions, document.Action) {
+			return fmt.Errorf("SSM document %s has unknown action %q", document.Name, document.Action)
+		}
+		for _, name := range document.Parameters {
+			if err := document.checkSettable(name); err != nil {
+				return err
+			}
+		}
+		documents[document.Name] = document
+	}
+	ssmDocuments = documents
+	return nil
+}
+
+// CheckParameters checks that the caller may set every given parameter of the document
+func (d SSMDocument) CheckParameters(parameters map[string][]string) error {
+	for name := range parameters {
+		if err := d.checkSettable(name); err != nil {
+			return err
+		}
+		if !containsString(d.Parameters, name) {
+			if len(d.Parameters) == 0 {
+				return fmt.Errorf("SSM document %s takes no parameters", d.Name)
+			}
+			return fmt.Errorf("parameter %s of SSM document %s cannot be set, expected one of %s", name, d.Name, strings.Join(d.Parameters, ", "))
+		}
+	}
+	return nil
+}
+
+// checkSettable rejects the parameters nobody may set: the target parameter of an Automation
+// document, which is set to each instance ID, and the role it runs as
+func (d SSMDocument) checkSettable(name string) error {
+	if d.Type == DocumentTypeAutomation && name == d.TargetParameter {
+		return fmt.Errorf("%s of SSM document %s is set to each instance ID and cannot be given", name, d.Name)
+	}
+	if name == automationAssumeRoleParameter {
+		return fmt.Errorf("%s of SSM document %s cannot be given, automations run as the command role", name, d.Name)
+	}
+	return nil
+}
+
+// ListSSMDocuments returns the documents operators may run, sorted by name
+func ListSSMDocuments() []SSMDocument {
+	var documents []SSMDocument
+	for _, document := range ssmDocuments {
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].Name < documents[j].Name })
+	return documents
+}
+
+// GetSSMDocument returns the document with the given name
+func GetSSMDocument(name string) (SSMDocument, bool) {
+	document, exists := ssmDocuments[name]
+	return document, exists
+}
+
+// ParseDocumentParameters parses document parameters written one per line as Name=value.
+// A name given on several lines becomes a list, e.g. the commands of AWS-RunShellScript.
+func ParseDocumentParameters(text string) (map[string][]string, error) {
+	parameters := make(map[string][]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("document parameter %q is not of the form Name=value", line)
+		}
+		parameters[name] = append(parameters[name], strings.TrimSpace(value))
+	}
+	return parameters, nil
+}
+
+// FormatDocumentParameters writes document parameters as Name=value pairs sorted by name,
+// with the values of a list separated by commas
+func FormatDocumentParameters(parameters map[string][]string) string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strings.Join(parameters[name], ","))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,153 @@
+// models/uptime_snapshot.go
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Days of uptime snapshots kept for the trends of the uptime report
+const uptimeSnapshotRetentionDays = 90
+
+// UptimeRecord is the uptime of one running instance in a snapshot, with every field the
+// report groups by, filters match and permissions are checked on
+type UptimeRecord struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Service          string            `json:"service"`
+	Owner            string            `json:"owner"`
+	AWSAccountName   string            `json:"aws_account_name"`
+	AWSAccountNumber string            `json:"aws_account_number,omitempty"`
+	Region           string            `json:"region,omitempty"`
+	EnvironmentClass string            `json:"environment_class"`
+	Source           string            `json:"source,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	UptimeDays       float64           `json:"uptime_days"`
+}
+
+// Instance returns the record as an instance, e.g. for permission checks and filters
+func (r UptimeRecord) Instance() EC2Instance {
+	return EC2Instance{
+		ID:               r.ID,
+		EC2Name:          r.Name,
+		Service:          r.Service,
+		Owner:            r.Owner,
+		AWSAccountName:   r.AWSAccountName,
+		AWSAccountNumber: r.AWSAccountNumber,
+		Region:           r.Region,
+		EnvironmentClass: r.EnvironmentClass,
+		Source:           r.Source,
+		Tags:             r.Tags,
+		State:            "running",
+		UptimeDays:       strconv.FormatFloat(r.UptimeDays, 'f', -1, 64),
+	}
+}
+
+// UptimeSnapshot is the uptime of the running instances on one day
+type UptimeSnapshot struct {
+	Date      string         `json:"date"` // 2006-01-02
+	TakenAt   time.Time      `json:"taken_at"`
+	Instances []UptimeRecord `json:"instances"`
+}
+
+// EC2Instances returns the instances of the snapshot
+func (s *UptimeSnapshot) EC2Instances() []EC2Instance {
+	instances := make([]EC2Instance, 0, len(s.Instances))
+	for _, record := range s.Instances {
+		instances = append(instances, record.Instance())
+	}
+	return instances
+}
+
+// UptimeSnapshotStore persists daily uptime snapshots
+type UptimeSnapshotStore interface {
+	SaveUptimeSnapshot(snapshot *UptimeSnapshot) error
+	// ListUptimeSnapshots returns all snapshots, oldest first
+	ListUptimeSnapshots() ([]*UptimeSnapshot, error)
+	// DeleteUptimeSnapshotsBefore removes the snapshots of days before date
+	DeleteUptimeSnapshotsBefore(date string) error
+}
+
+var (
+	uptimeSnapshotStore    UptimeSnapshotStore
+	uptimeSnapshotLock     sync.Mutex
+	lastUptimeSnapshotDate string
+)
+
+// InjectUptimeSnapshotStore injects the store used for uptime snapshots
+func InjectUptimeSnapshotStore(store UptimeSnapshotStore) {
+	uptimeSnapshotStore = store
+}
+
+// RecordUptimeSnapshot saves the uptime of the running instances of the current inventory,
+// once per day, and drops snapshots older than the retention period
+func RecordUptimeSnapshot(now time.Time) error {
+	if uptimeSnapshotStore == nil {
+		return nil
+	}
+	uptimeSnapshotLock.Lock()
+	defer uptimeSnapshotLock.Unlock()
+
+	date := now.Format("2006-01-02")
+	if date == lastUptimeSnapshotDate {
+		return nil
+	}
+
+	snapshot := &UptimeSnapshot{Date: date, TakenAt: now}
+	for _, instance := range GetInstances() {
+		days, known := instance.Uptime()
+		if !known || !instance.IsRunning() {
+			continue
+		}
+		snapshot.Instances = append(snapshot.Instances, UptimeRecord{
+			ID:               instance.ID,
+			Name:             instance.EC2Name,
+			Service:          instance.Service,
+			Owner:            instance.Owner,
+			AWSAccountName:   instance.AWSAccountName,
+			AWSAccountNumber: instance.AWSAccountNumber,
+			Region:           instance.Region,
+			EnvironmentClass: instance.EnvironmentClass,
+			Source:           instance.Source,
+			Tags:             instance.Tags,
+			UptimeDays:       days,
+		})
+	}
+	if err := uptimeSnapshotStore.SaveUptimeSnapshot(snapshot); err != nil {
+		return fmt.Errorf("failed to save uptime snapshot: %w", err)
+	}
+	lastUptimeSnapshotDate = date
+
+	cutoff := now.AddDate(0, 0, -uptimeSnapshotRetentionDays).Format("2006-01-02")
+	if err := uptimeSnapshotStore.DeleteUptimeSnapshotsBefore(cutoff); err != nil {
+		return fmt.Errorf("failed to delete old uptime snapshots: %w", err)
+	}
+	return nil
+}
+
+// FindUptimeSnapshot returns the newest snapshot taken at least days before now, or the
+// oldest one if none is that old, or nil if there is no snapshot before today
+func FindUptimeSnapshot(now time.Time, days int) (*UptimeSnapshot, error) {
+	if uptimeSnapshotStore == nil {
+		return nil, nil
+	}
+	snapshots, err := uptimeSnapshotStore.ListUptimeSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	today := now.Format("2006-01-02")
+	target := now.AddDate(0, 0, -days).Format("2006-01-02")
+	var found *UptimeSnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Date >= today {
+			break
+		}
+		if found == nil || snapshot.Date <= target {
+			found = snapshot
+		}
+	}
+	return found, nil
+}
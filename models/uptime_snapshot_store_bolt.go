@@ -0,0 +1,70 @@
+// models/uptime_snapshot_store_bolt.go
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Uptime snapshots are stored by date, so that keys sort oldest first. The bucket is created
+// with the first snapshot.
+var uptimeSnapshotsBucket = []byte("uptime_snapshots")
+
+// SaveUptimeSnapshot stores a snapshot, replacing any snapshot of the same day
+func (s *BoltJobStore) SaveUptimeSnapshot(snapshot *UptimeSnapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal uptime snapshot %s: %w", snapshot.Date, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(uptimeSnapshotsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(snapshot.Date), value)
+	})
+}
+
+// ListUptimeSnapshots returns all snapshots, oldest first
+func (s *BoltJobStore) ListUptimeSnapshots() ([]*UptimeSnapshot, error) {
+	var snapshots []*UptimeSnapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(uptimeSnapshotsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var snapshot UptimeSnapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return fmt.Errorf("failed to unmarshal uptime snapshot %s: %w", key, err)
+			}
+			snapshots = append(snapshots, &snapshot)
+			return nil
+		})
+	})
+	return snapshots, err
+}
+
+// DeleteUptimeSnapshotsBefore removes the snapshots of days before date
+func (s *BoltJobStore) DeleteUptimeSnapshotsBefore(date string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(uptimeSnapshotsBucket)
+		if bucket == nil {
+			return nil
+		}
+		var old [][]byte
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, []byte(date)) < 0; key, _ = cursor.Next() {
+			old = append(old, append([]byte(nil), key...))
+		}
+		for _, key := range old {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
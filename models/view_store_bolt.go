@@ -0,0 +1,80 @@
+// models/view_store_bolt.go
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Views are stored by ID; the bucket is created with the first view
+var viewsBucket = []byte("views")
+
+// SaveView stores a view, replacing any view with the same ID
+func (s *BoltJobStore) SaveView(view *SavedView) error {
+	value, err := json.Marshal(view)
+	if err != nil {
+		return fmt.Errorf("failed to marshal view %s: %w", view.ID, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(viewsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(view.ID), value)
+	})
+}
+
+// GetView retrieves a view by its ID
+func (s *BoltJobStore) GetView(id string) (*SavedView, error) {
+	var view SavedView
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var value []byte
+		if bucket := tx.Bucket(viewsBucket); bucket != nil {
+			value = bucket.Get([]byte(id))
+		}
+		if value == nil {
+			return fmt.Errorf("view %s not found", id)
+		}
+		if err := json.Unmarshal(value, &view); err != nil {
+			return fmt.Errorf("failed to unmarshal view %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// DeleteView removes a view
+func (s *BoltJobStore) DeleteView(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(viewsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// ListViews returns all views
+func (s *BoltJobStore) ListViews() ([]*SavedView, error) {
+	var views []*SavedView
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(viewsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			var view SavedView
+			if err := json.Unmarshal(value, &view); err != nil {
+				return fmt.Errorf("failed to unmarshal view: %w", err)
+			}
+			views = append(views, &view)
+			return nil
+		})
+	})
+	return views, err
+}
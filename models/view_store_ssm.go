@@ -0,0 +1,73 @@
+// models/view_store_ssm.go
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"ec2-restart-manager/aws"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// ParameterViewStore stores each view as a JSON parameter below a path in Parameter Store,
+// e.g. /ec2-restart-manager/prod/views/<id> next to the schedule
+type ParameterViewStore struct {
+	client *ssm.Client
+	path   string
+}
+
+// NewParameterViewStore creates a store keeping views below path
+func NewParameterViewStore(client *ssm.Client, path string) *ParameterViewStore {
+	return &ParameterViewStore{client: client, path: strings.TrimSuffix(path, "/")}
+}
+
+// SaveView stores a view, replacing any view with the same ID
+func (s *ParameterViewStore) SaveView(view *SavedView) error {
+	value, err := json.Marshal(view)
+	if err != nil {
+		return fmt.Errorf("failed to marshal view %s: %w", view.ID, err)
+	}
+	return aws.PutParameter(s.client, s.parameterName(view.ID), string(value))
+}
+
+// GetView retrieves a view by its ID
+func (s *ParameterViewStore) GetView(id string) (*SavedView, error) {
+	value, err := aws.GetParameter(s.client, s.parameterName(id))
+	if err != nil {
+		return nil, fmt.Errorf("view %s not found: %w", id, err)
+	}
+	var view SavedView
+	if err := json.Unmarshal([]byte(value), &view); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal view %s: %w", id, err)
+	}
+	return &view, nil
+}
+
+// DeleteView removes a view
+func (s *ParameterViewStore) DeleteView(id string) error {
+	return aws.DeleteParameter(s.client, s.parameterName(id))
+}
+
+// ListViews returns all views
+func (s *ParameterViewStore) ListViews() ([]*SavedView, error) {
+	parameters, err := aws.GetParametersByPath(s.client, s.path)
+	if err != nil {
+		return nil, err
+	}
+	var views []*SavedView
+	for name, value := range parameters {
+		var view SavedView
+		if err := json.Unmarshal([]byte(value), &view); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal view %s: %w", name, err)
+		}
+		views = append(views, &view)
+	}
+	return views, nil
+}
+
+// parameterName is the name of the parameter holding a view
+func (s *ParameterViewStore) parameterName(id string) string {
+	return s.path + "/" + id
+}
@@ -0,0 +1,157 @@
+// utils/instance_filter.go
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// InstanceFilter selects instances. Every non-empty condition must match; a condition with
+// several values matches any of them.
+type InstanceFilter struct {
+	Owners             []string
+	Services           []string
+	AWSAccountNames    []string
+	Regions            []string
+	EnvironmentClasses []string
+	Tags               map[string][]string // Tag name to the values it may have
+	Search             string              // Case-insensitive text in the name, ID or a tag value
+	MinUptimeDays      float64             // Only instances up for more than this many days; 0 for all
+	Expression         *InstanceQuery      // Filter expression, see InstanceQuery
+}
+
+// ParseInstanceFilter reads a filter from query parameters: owner, service, account, region
+// and environment_class may be repeated, tags are given as tag:<name>=<value>, q is the
+// free-text search, min_uptime_days the uptime threshold and query a filter expression.
+// An invalid uptime threshold or filter expression is an error.
+func ParseInstanceFilter(query url.Values) (InstanceFilter, error) {
+	filter := InstanceFilter{
+		Owners:             nonEmpty(query["owner"]),
+		Services:           nonEmpty(query["service"]),
+		AWSAccountNames:    nonEmpty(query["account"]),
+		Regions:            nonEmpty(query["region"]),
+		EnvironmentClasses: nonEmpty(query["environment_class"]),
+		Tags:               make(map[string][]string),
+		Search:             strings.TrimSpace(query.Get("q")),
+	}
+	for key, values := range query {
+		if name, isTag := strings.CutPrefix(key, "tag:"); isTag && len(nonEmpty(values)) > 0 {
+			filter.Tags[name] = nonEmpty(values)
+		}
+	}
+	if value := strings.TrimSpace(query.Get("min_uptime_days")); value != "" {
+		days, err := models.ParseNumber(value)
+		if err != nil || days < 0 {
+			return filter, fmt.Errorf("min_uptime_days must be a non-negative number of days, got %q", value)
+		}
+		filter.MinUptimeDays = days
+	}
+	if text := strings.TrimSpace(query.Get("query")); text != "" {
+		parsed, err := ParseInstanceQuery(text)
+		if err != nil {
+			return filter, err
+		}
+		filter.Expression = parsed
+	}
+	return filter, nil
+}
+
+// Query encodes the filter as query parameters, the inverse of ParseInstanceFilter
+func (f InstanceFilter) Query() url.Values {
+	query := url.Values{}
+	for _, param := range []struct {
+		name   string
+		values []string
+	}{
+		{"owner", f.Owners},
+		{"service", f.Services},
+		{"account", f.AWSAccountNames},
+		{"region", f.Regions},
+		{"environment_class", f.EnvironmentClasses},
+	} {
+		for _, value := range param.values {
+			query.Add(param.name, value)
+		}
+	}
+	for name, values := range f.Tags {
+		for _, value := range values {
+			query.Add("tag:"+name, value)
+		}
+	}
+	if f.Search != "" {
+		query.Set("q", f.Search)
+	}
+	if f.MinUptimeDays > 0 {
+		query.Set("min_uptime_days", strconv.FormatFloat(f.MinUptimeDays, 'f', -1, 64))
+	}
+	if f.Expression != nil {
+		query.Set("query", f.Expression.String())
+	}
+	return query
+}
+
+// IsEmpty checks if the filter selects every instance
+func (f InstanceFilter) IsEmpty() bool {
+	return len(f.Query()) == 0
+}
+
+// Matches checks if the instance matches every condition of the filter
+func (f InstanceFilter) Matches(instance models.EC2Instance) bool {
+	if !matchesAny(f.Owners, instance.Owner) ||
+		!matchesAny(f.Services, instance.Service) ||
+		!matchesAny(f.AWSAccountNames, instance.AWSAccountName) ||
+		!matchesAny(f.Regions, instance.Region) ||
+		!matchesAny(f.EnvironmentClasses, instance.EnvironmentClass) {
+		return false
+	}
+	for name, values := range f.Tags {
+		if !matchesAny(values, instance.Tags[name]) {
+			return false
+		}
+	}
+	if f.MinUptimeDays > 0 {
+		days, known := instance.Uptime()
+		if !known || days <= f.MinUptimeDays {
+			return false
+		}
+	}
+	if f.Expression != nil && !f.Expression.Matches(instance) {
+		return false
+	}
+	return f.Search == "" || matchesSearch(instance, f.Search)
+}
+
+// matchesAny checks if value is one of values; no values match everything
+func matchesAny(values []string, value string) bool {
+	return len(values) == 0 || contains(values, value)
+}
+
+// matchesSearch checks if the instance name, ID or a tag value contains the search text
+func matchesSearch(instance models.EC2Instance, search string) bool {
+	search = strings.ToLower(search)
+	if strings.Contains(strings.ToLower(instance.EC2Name), search) ||
+		strings.Contains(strings.ToLower(instance.ID), search) {
+		return true
+	}
+	for _, value := range instance.Tags {
+		if strings.Contains(strings.ToLower(value), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// nonEmpty returns the values that are not blank
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+
+	"ec2-restart-manager/models"
+)
+
+func TestMinUptimeDays(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string // IDs of the matching instances, comma-separated
+		wantErr bool
+	}{
+		{"", "i-a,i-b,i-c", false},
+		{"0", "i-a,i-b,i-c", false},
+		{"45", "i-a", false},
+		{" 9.5 ", "i-a,i-b", false},
+		{"10", "i-a", false},
+		{"many", "", true},
+		{"-1", "", true},
+		{"NaN", "", true},
+		{"Inf", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			filter, err := ParseInstanceFilter(url.Values{"min_uptime_days": {test.value}})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("min_uptime_days=%q was accepted", test.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := matchingIDs(FilterInstances(queryTestInstances, filter)); got != test.want {
+				t.Errorf("matched %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestMinUptimeDaysAgreesWithQuery checks that min_uptime_days and the uptime field of a
+// filter expression select the same instances
+func TestMinUptimeDaysAgreesWithQuery(t *testing.T) {
+	for _, days := range []string{"9.5", "10", "59.9", "60"} {
+		filter, err := ParseInstanceFilter(url.Values{"min_uptime_days": {days}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expression, err := ParseInstanceFilter(url.Values{"query": {"uptime>" + days}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		byFilter := matchingIDs(FilterInstances(queryTestInstances, filter))
+		byQuery := matchingIDs(FilterInstances(queryTestInstances, expression))
+		if byFilter != byQuery {
+			t.Errorf("min_uptime_days=%s matched %q, uptime>%s matched %q", days, byFilter, days, byQuery)
+		}
+	}
+}
+
+func TestInstanceFilterQueryRoundTrip(t *testing.T) {
+	filter, err := ParseInstanceFilter(url.Values{"min_uptime_days": {"2.5"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := filter.Query().Get("min_uptime_days"); got != "2.5" {
+		t.Errorf("min_uptime_days encoded as %q", got)
+	}
+}
+
+// matchingIDs joins the IDs of the instances with commas
+func matchingIDs(instances []models.EC2Instance) string {
+	ids := ""
+	for i, instance := range instances {
+		if i > 0 {
+			ids += ","
+		}
+		ids += instance.ID
+	}
+	return ids
+}
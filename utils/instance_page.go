@@ -0,0 +1,123 @@
+// utils/instance_page.go
+package utils
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// Page sizes offered for instance lists; the first is the default
+var PageSizes = []int{50, 100, 250, 1000}
+
+// InstanceOrder sorts instances by a field or tag
+type InstanceOrder struct {
+	Field      string // Instance field, see models.InstanceFields, "source" or a tag name
+	Descending bool
+}
+
+// ParseInstanceOrder reads the sort order from the sort and order query parameters,
+// sorting by name in ascending order by default
+func ParseInstanceOrder(query url.Values) InstanceOrder {
+	order := InstanceOrder{Field: strings.TrimSpace(query.Get("sort"))}
+	if order.Field == "" {
+		order.Field = "name"
+	}
+	order.Descending = query.Get("order") == "desc"
+	return order
+}
+
+// Query encodes the order as query parameters, the inverse of ParseInstanceOrder
+func (o InstanceOrder) Query() url.Values {
+	query := url.Values{"sort": {o.Field}}
+	if o.Descending {
+		query.Set("order", "desc")
+	}
+	return query
+}
+
+// SortInstances sorts instances in place. Uptime is compared as a number, read the way
+// filters read it, with unknown uptimes last, and other fields as text ignoring case. Ties are broken by instance ID so
+// that the order is stable across page loads.
+func SortInstances(instances []models.EC2Instance, order InstanceOrder) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		a, b := instances[i], instances[j]
+		if order.Field == "uptime_days" {
+			aDays, aKnown := a.Uptime()
+			bDays, bKnown := b.Uptime()
+			if aKnown != bKnown {
+				return aKnown
+			}
+			if aKnown && aDays != bDays {
+				return (aDays < bDays) != order.Descending
+			}
+		} else if compared := compareFold(a.Field(order.Field), b.Field(order.Field)); compared != 0 {
+			return (compared < 0) != order.Descending
+		}
+		return a.ID < b.ID
+	})
+}
+
+// compareFold compares two texts ignoring case and surrounding space, returning -1, 0 or 1
+func compareFold(x, y string) int {
+	return strings.Compare(strings.ToLower(strings.TrimSpace(x)), strings.ToLower(strings.TrimSpace(y)))
+}
+
+// InstancePage is one page of a list of instances
+type InstancePage struct {
+	Number int // From 1
+	Size   int
+	Total  int // Instances on all pages
+}
+
+// ParseInstancePage reads the page and per_page query parameters. Sizes other than
+// PageSizes fall back to the default size, and pages beyond the last to the last page.
+func ParseInstancePage(query url.Values, total int) InstancePage {
+	page := InstancePage{Number: 1, Size: PageSizes[0], Total: total}
+	if size, err := strconv.Atoi(query.Get("per_page")); err == nil && containsInt(PageSizes, size) {
+		page.Size = size
+	}
+	if number, err := strconv.Atoi(query.Get("page")); err == nil && number > 1 {
+		page.Number = min(number, page.Pages())
+	}
+	return page
+}
+
+// Pages is the number of pages, at least 1
+func (p InstancePage) Pages() int {
+	return max(1, (p.Total+p.Size-1)/p.Size)
+}
+
+// First is the position of the first instance on the page, from 1, or 0 for no instances
+func (p InstancePage) First() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return (p.Number-1)*p.Size + 1
+}
+
+// Last is the position of the last instance on the page
+func (p InstancePage) Last() int {
+	return min(p.Number*p.Size, p.Total)
+}
+
+// Slice returns the instances on the page
+func (p InstancePage) Slice(instances []models.EC2Instance) []models.EC2Instance {
+	if p.Total == 0 {
+		return instances[:0]
+	}
+	return instances[p.First()-1 : p.Last()]
+}
+
+// containsInt checks if a slice contains a number
+func containsInt(slice []int, item int) bool {
+	for _, value := range slice {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
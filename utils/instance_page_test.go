@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"ec2-restart-manager/models"
+)
+
+func TestSortInstancesByUptime(t *testing.T) {
+	instances := func() []models.EC2Instance {
+		return []models.EC2Instance{
+			{ID: "i-a", UptimeDays: "10"},
+			{ID: "i-b", UptimeDays: " 2.5 "},
+			{ID: "i-c", UptimeDays: ""},
+			{ID: "i-d", UptimeDays: "9.75"},
+			{ID: "i-e", UptimeDays: "unknown"},
+			{ID: "i-f", UptimeDays: "10.0"},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		descending bool
+		want       string
+	}{
+		{"ascending", false, "i-b,i-d,i-a,i-f,i-c,i-e"},
+		{"descending", true, "i-a,i-f,i-d,i-b,i-c,i-e"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sorted := instances()
+			SortInstances(sorted, InstanceOrder{Field: "uptime_days", Descending: test.descending})
+			var ids []string
+			for _, instance := range sorted {
+				ids = append(ids, instance.ID)
+			}
+			if got := strings.Join(ids, ","); got != test.want {
+				t.Errorf("sorted %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+// utils/instance_query.go
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ec2-restart-manager/models"
+)
+
+// InstanceQuery is a parsed filter expression such as
+//
+//	env=prod AND service~"payments-*" AND uptime>45 AND NOT owner=legacy
+//
+// Comparisons are joined with AND, OR and NOT, which may be grouped with parentheses;
+// AND binds more tightly than OR. The operators are = and != (case-insensitive equality),
+// ~ and !~ (case-insensitive glob with * and ?) and >, >=, <, <= (numeric). Fields are
+// instance fields or tags, written tag:<name> or tag:"<name>"; values containing spaces or
+// operator characters are quoted with double quotes.
+type InstanceQuery struct {
+	text string
+	root queryNode
+}
+
+// QueryError is a syntax error in a filter expression at a 1-based character position
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Position, e.Message)
+}
+
+// queryFields maps the field names of the query language to instance fields
+var queryFields = map[string]string{
+	"name":               "name",
+	"id":                 "id",
+	"owner":              "owner",
+	"service":            "service",
+	"region":             "region",
+	"state":              "state",
+	"source":             "source",
+	"env":                "environment_class",
+	"environment":        "environment_class",
+	"environment_class":  "environment_class",
+	"account":            "aws_account_name",
+	"account_name":       "aws_account_name",
+	"aws_account_name":   "aws_account_name",
+	"account_id":         "aws_account_number",
+	"aws_account_number": "aws_account_number",
+	"uptime":             "uptime_days",
+	"uptime_days":        "uptime_days",
+}
+
+// ParseInstanceQuery parses a filter expression
+func ParseInstanceQuery(text string) (*InstanceQuery, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return nil, &QueryError{Position: 1, Message: "the query is empty"}
+	}
+
+	parser := &queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEnd {
+		if token.kind == tokenRightParen {
+			return nil, &QueryError{Position: token.position, Message: `")" without a matching "("`}
+		}
+		return nil, &QueryError{Position: token.position, Message: fmt.Sprintf("expected AND or OR, found %s", token)}
+	}
+	return &InstanceQuery{text: strings.TrimSpace(text), root: root}, nil
+}
+
+// Matches checks if the instance matches the expression
+func (q *InstanceQuery) Matches(instance models.EC2Instance) bool {
+	return q.root.matches(instance)
+}
+
+// String returns the expression as it was written
+func (q *InstanceQuery) String() string {
+	return q.text
+}
+
+// Kinds of query tokens
+const (
+	tokenEnd = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+// queryToken is a token of a filter expression and its 1-based position
+type queryToken struct {
+	kind     int
+	text     string
+	position int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "the end of the query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// isKeyword checks if the token is the given keyword; keywords are not case-sensitive
+func (t queryToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// queryOperators lists the comparison operators, longest first so that they are matched greedily
+var queryOperators = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<"}
+
+// tokenizeQuery splits a filter expression into tokens, ending with a tokenEnd
+func tokenizeQuery(text string) ([]queryToken, error) {
+	runes := []rune(text)
+	var tokens []queryToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLeftParen, text: "(", position: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRightParen, text: ")", position: i + 1})
+			i++
+		case r == '"':
+			start := i
+			var value strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, &QueryError{Position: start + 1, Message: "unterminated quoted string"}
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					value.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '"' {
+					break
+				}
+				value.WriteRune(runes[i])
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, text: value.String(), position: start + 1})
+			i++
+		case strings.ContainsRune("=!~<>", r):
+			operator := ""
+			for _, candidate := range queryOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, &QueryError{Position: i + 1, Message: fmt.Sprintf("unknown operator %q, expected one of %s", string(r), strings.Join(queryOperators, " "))}
+			}
+			tokens = append(tokens, queryToken{kind: tokenOperator, text: operator, position: i + 1})
+			i += len([]rune(operator))
+		default:
+			start := i
+			for i < len(runes) && !strings.ContainsRune(" \t\n\r()\"=!~<>", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, text: string(runes[start:i]), position: start + 1})
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEnd, position: len(runes) + 1}), nil
+}
+
+// queryParser is a recursive descent parser over the tokens of a filter expression
+type queryParser struct {
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) advance() queryToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEnd {
+		p.next++
+	}
+	return token
+}
+
+// parseOr parses comparisons joined by OR
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses comparisons joined by AND
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("AND") {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a negation, a parenthesized expression or a comparison
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.peek()
+	switch {
+	case token.isKeyword("NOT"):
+		p.advance()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	case token.kind == tokenLeftParen:
+		p.advance()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRightParen {
+			return nil, &QueryError{Position: closing.position, Message: fmt.Sprintf(`expected ")" to close the "(" at position %d, found %s`, token.position, closing)}
+		}
+		return inner, nil
+	default:
+		return p.parseComparison()
+	}
+}
+
+// parseComparison parses a field, an operator and a value
+func (p *queryParser) parseComparison() (queryNode, error) {
+	fieldToken := p.advance()
+	if fieldToken.kind != tokenWord && fieldToken.kind != tokenString {
+		return nil, &QueryError{Position: fieldToken.position, Message: fmt.Sprintf("expected a field name, found %s", fieldToken)}
+	}
+	if fieldToken.kind == tokenWord && (fieldToken.isKeyword("AND") || fieldToken.isKeyword("OR")) {
+		return nil, &QueryError{Position: fieldToken.position, Message: fmt.Sprintf("expected a field name before %s", fieldToken)}
+	}
+
+	// A quoted tag name may follow tag: directly, as in tag:"Patch Group"
+	if fieldToken.kind == tokenWord && fieldToken.text == "tag:" && p.peek().kind == tokenString {
+		fieldToken.text += p.advance().text
+	}
+
+	comparison := comparisonNode{}
+	if tag, isTag := strings.CutPrefix(fieldToken.text, "tag:"); isTag {
+		if tag == "" {
+			return nil, &QueryError{Position: fieldToken.position, Message: "expected a tag name after tag:"}
+		}
+		comparison.tag = tag
+	} else if field, known := queryFields[strings.ToLower(fieldToken.text)]; known {
+		comparison.field = field
+	} else {
+		return nil, &QueryError{Position: fieldToken.position, Message: fmt.Sprintf(
+			"unknown field %q, expected one of %s, or tag:<name> for a tag", fieldToken.text, strings.Join(queryFieldNames(), ", "))}
+	}
+
+	operatorToken := p.advance()
+	if operatorToken.kind != tokenOperator {
+		return nil, &QueryError{Position: operatorToken.position, Message: fmt.Sprintf("expected an operator after %s, found %s", fieldToken, operatorToken)}
+	}
+	comparison.operator = operatorToken.text
+
+	valueToken := p.advance()
+	if valueToken.kind != tokenWord && valueToken.kind != tokenString {
+		return nil, &QueryError{Position: valueToken.position, Message: fmt.Sprintf("expected a value after %q, found %s", operatorToken.text, valueToken)}
+	}
+	comparison.value = valueToken.text
+
+	switch comparison.operator {
+	case "~", "!~":
+		comparison.pattern = globPattern(comparison.value)
+	case ">", ">=", "<", "<=":
+		number, err := models.ParseNumber(comparison.value)
+		if err != nil {
+			return nil, &QueryError{Position: valueToken.position, Message: fmt.Sprintf("expected a number after %q, found %s", operatorToken.text, valueToken)}
+		}
+		comparison.number = number
+	}
+	return comparison, nil
+}
+
+// queryFieldNames lists the field names of the query language
+func queryFieldNames() []string {
+	var names []string
+	for name := range queryFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// globPattern compiles a glob with * and ? into a case-insensitive regular expression
+func globPattern(glob string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return regexp.MustCompile("(?is)^" + pattern + "$")
+}
+
+// queryNode is a node of a parsed filter expression
+type queryNode interface {
+	matches(instance models.EC2Instance) bool
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n andNode) matches(instance models.EC2Instance) bool {
+	return n.left.matches(instance) && n.right.matches(instance)
+}
+
+type orNode struct{ left, right queryNode }
+
+func (n orNode) matches(instance models.EC2Instance) bool {
+	return n.left.matches(instance) || n.right.matches(instance)
+}
+
+type notNode struct{ operand queryNode }
+
+func (n notNode) matches(instance models.EC2Instance) bool {
+	return !n.operand.matches(instance)
+}
+
+// comparisonNode compares an instance field or tag with a value
+type comparisonNode struct {
+	field    string // Instance field, or empty for a tag
+	tag      string
+	operator string
+	value    string
+	pattern  *regexp.Regexp // For ~ and !~
+	number   float64        // For numeric operators
+}
+
+func (n comparisonNode) matches(instance models.EC2Instance) bool {
+	var actual string
+	if n.tag != "" {
+		actual = tagValue(instance, n.tag)
+	} else {
+		actual = instance.Field(n.field)
+	}
+
+	switch n.operator {
+	case "=":
+		return strings.EqualFold(actual, n.value)
+	case "!=":
+		return !strings.EqualFold(actual, n.value)
+	case "~":
+		return n.pattern.MatchString(actual)
+	case "!~":
+		return !n.pattern.MatchString(actual)
+	}
+
+	// Numeric comparisons never match instances without a numeric value
+	number, err := models.ParseNumber(actual)
+	if err != nil {
+		return false
+	}
+	switch n.operator {
+	case ">":
+		return number > n.number
+	case ">=":
+		return number >= n.number
+	case "<":
+		return number < n.number
+	default:
+		return number <= n.number
+	}
+}
+
+// tagValue returns the named tag, falling back to a case-insensitive match of its name
+func tagValue(instance models.EC2Instance, name string) string {
+	if value, exists := instance.Tags[name]; exists {
+		return value
+	}
+	for tag, value := range instance.Tags {
+		if strings.EqualFold(tag, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ec2-restart-manager/models"
+)
+
+// queryTestInstances are matched against the expressions of TestInstanceQueryMatches
+var queryTestInstances = []models.EC2Instance{
+	{
+		ID: "i-a", EC2Name: "web-1", EnvironmentClass: "prod", Service: "payments-api",
+		Owner: "team-a", UptimeDays: "60", Tags: map[string]string{"Patch Group": "group 1"},
+	},
+	{
+		ID: "i-b", EC2Name: `worker "blue"`, EnvironmentClass: "dev", Service: "payments-worker",
+		Owner: "legacy", UptimeDays: "10",
+	},
+	{
+		ID: "i-c", EC2Name: "web-10", EnvironmentClass: "prod", Service: "billing",
+		Owner: "team-b", UptimeDays: "", Tags: map[string]string{"Platform": "windows"},
+	},
+}
+
+func TestInstanceQueryMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // IDs of the matching instances, comma-separated
+	}{
+		{`env=prod`, "i-a,i-c"},
+		{`ENV=PROD`, "i-a,i-c"},
+		{`env!=prod`, "i-b"},
+
+		// AND binds more tightly than OR, NOT more tightly than both
+		{`env=prod OR env=dev AND owner=team-b`, "i-a,i-c"},
+		{`env=dev AND owner=team-b OR env=prod`, "i-a,i-c"},
+		{`NOT env=prod`, "i-b"},
+		{`NOT env=prod OR owner=team-a`, "i-a,i-b"},
+		{`NOT NOT env=dev`, "i-b"},
+		{`env=prod and not owner=team-b`, "i-a"},
+
+		// Parentheses
+		{`(env=prod OR env=dev) AND owner=team-b`, "i-c"},
+		{`NOT (env=prod OR owner=legacy)`, ""},
+		{`((env=dev))`, "i-b"},
+
+		// Quoting
+		{`owner="team-a"`, "i-a"},
+		{`name="worker \"blue\""`, "i-b"},
+		{`tag:"Patch Group"="group 1"`, "i-a"},
+		{`tag:platform=WINDOWS`, "i-c"},
+		{`tag:missing=""`, "i-a,i-b,i-c"},
+
+		// Globs
+		{`service~"payments-*"`, "i-a,i-b"},
+		{`service~PAY*`, "i-a,i-b"},
+		{`service!~payments-*`, "i-c"},
+		{`name~web-?`, "i-a"},
+		{`name~"web-1*"`, "i-a,i-c"},
+		{`name~"worker (blue)"`, ""},
+
+		// Numeric comparisons skip instances without a numeric value
+		{`uptime>45`, "i-a"},
+		{`uptime>=10`, "i-a,i-b"},
+		{`uptime<=10`, "i-b"},
+		{`uptime_days<10.5`, "i-b"},
+		{`uptime>-1 AND env=prod`, "i-a"},
+		{`uptime!=60`, "i-b,i-c"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := ParseInstanceQuery(test.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var matched []string
+			for _, instance := range queryTestInstances {
+				if query.Matches(instance) {
+					matched = append(matched, instance.ID)
+				}
+			}
+			if got := strings.Join(matched, ","); got != test.want {
+				t.Errorf("matched %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInstanceQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+		message  string
+	}{
+		{``, 1, "the query is empty"},
+		{`   `, 1, "the query is empty"},
+		{`colour=red`, 1, `unknown field "colour"`},
+		{`tag:=x`, 1, "expected a tag name after tag:"},
+		{`env prod`, 5, `expected an operator after "env", found "prod"`},
+		{`env!prod`, 4, `unknown operator "!"`},
+		{`env=`, 5, `expected a value after "=", found the end of the query`},
+		{`env==prod`, 5, `expected a value after "=", found "="`},
+		{`name="web`, 6, "unterminated quoted string"},
+		{`uptime>many`, 8, `expected a number after ">", found "many"`},
+		{`env=prod AND`, 13, "expected a field name, found the end of the query"},
+		{`env=prod OR AND env=dev`, 13, `expected a field name before "AND"`},
+		{`env=prod owner=a`, 10, `expected AND or OR, found "owner"`},
+		{`(env=prod`, 10, `expected ")" to close the "(" at position 1, found the end of the query`},
+		{`env=prod)`, 9, `")" without a matching "("`},
+		{`NOT`, 4, "expected a field name, found the end of the query"},
+		{`()`, 2, `expected a field name, found ")"`},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			_, err := ParseInstanceQuery(test.query)
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("got error %v, want a *QueryError", err)
+			}
+			if queryErr.Position != test.position || !strings.Contains(queryErr.Message, test.message) {
+				t.Errorf("got %q at position %d, want %q at position %d", queryErr.Message, queryErr.Position, test.message, test.position)
+			}
+		})
+	}
+}
+
+func TestInstanceQueryString(t *testing.T) {
+	query, err := ParseInstanceQuery("  env=prod AND uptime>45 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := query.String(); got != "env=prod AND uptime>45" {
+		t.Errorf("String() = %q", got)
+	}
+
+	_, err = ParseInstanceQuery("env=")
+	if got := err.Error(); got != `invalid query at position 5: expected a value after "=", found the end of the query` {
+		t.Errorf("Error() = %q", got)
+	}
+}
@@ -73,15 +73,60 @@ func GetUniqueRegions(instances []models.EC2Instance) []string {
     return regions
 }
 
-func FilterInstances(instances []models.EC2Instance, owner, service, awsAccountName, region string) []models.EC2Instance {
+func GetUniqueEnvironmentClasses(instances []models.EC2Instance) []string {
+    var classes []string
+    for _, instance := range instances {
+        class := strings.TrimSpace(instance.EnvironmentClass)
+        if class != "" {
+            if !contains(classes, class) {
+                classes = append(classes, class)
+            }
+        }
+    }
+    sort.Strings(classes)
+    return classes
+}
+
+// TagValues are the distinct values of one tag across instances
+type TagValues struct {
+    Name   string
+    Values []string
+}
+
+// GetUniqueTagValues returns the sorted values of the named tags, or of every tag if no
+// names are given, leaving out tags without any value
+func GetUniqueTagValues(instances []models.EC2Instance, names []string) []TagValues {
+    values := make(map[string][]string)
+    for _, instance := range instances {
+        for name, value := range instance.Tags {
+            value = strings.TrimSpace(value)
+            if value == "" || (len(names) > 0 && !contains(names, name)) {
+                continue
+            }
+            if !contains(values[name], value) {
+                values[name] = append(values[name], value)
+            }
+        }
+    }
+
+    var tags []TagValues
+    for name, tagValues := range values {
+        sort.Strings(tagValues)
+        tags = append(tags, TagValues{Name: name, Values: tagValues})
+    }
+    sort.Slice(tags, func(i, j int) bool {
+        return tags[i].Name < tags[j].Name
+    })
+    return tags
+}
+
+// FilterInstances returns the instances matching the filter
+func FilterInstances(instances []models.EC2Instance, filter InstanceFilter) []models.EC2Instance {
     var filtered []models.EC2Instance
     for _, instance := range instances {
-        if (owner == "" || instance.Owner == owner) &&
-            (service == "" || instance.Service == service) &&
-            (awsAccountName == "" || instance.AWSAccountName == awsAccountName) &&
-            (region == "" || instance.Region == region) {
+        if filter.Matches(instance) {
             filtered = append(filtered, instance)
         }
     }
     return filtered
-}
\ No newline at end of file
+}
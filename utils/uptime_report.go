@@ -0,0 +1,190 @@
+// utils/uptime_report.go
+package utils
+
+import (
+	"sort"
+
+	"ec2-restart-manager/models"
+)
+
+// UptimeReportDimensions are the instance fields the uptime report groups by
+var UptimeReportDimensions = []struct {
+	Field string
+	Label string
+}{
+	{"service", "Service"},
+	{"owner", "Owner"},
+	{"aws_account_name", "AWS Account"},
+}
+
+// UptimeStats summarises the uptime of a set of running instances
+type UptimeStats struct {
+	Instances     int // Instances with a known uptime
+	P50           int
+	P90           int
+	Max           int
+	OverThreshold int // Instances up for more than the threshold
+}
+
+// UptimeTrend is the change of a group's uptime since an earlier snapshot
+type UptimeTrend struct {
+	Current  UptimeStats
+	Previous *UptimeStats // Nil without an earlier snapshot or if the group did not exist then
+}
+
+// P50Change is the change of the median uptime in days
+func (t UptimeTrend) P50Change() int {
+	if t.Previous == nil {
+		return 0
+	}
+	return t.Current.P50 - t.Previous.P50
+}
+
+// OverThresholdChange is the change of the number of instances over the threshold
+func (t UptimeTrend) OverThresholdChange() int {
+	if t.Previous == nil {
+		return 0
+	}
+	return t.Current.OverThreshold - t.Previous.OverThreshold
+}
+
+// UptimeGroup is the instances sharing a value of a dimension, e.g. one service
+type UptimeGroup struct {
+	Name   string
+	Trend  UptimeTrend
+	Owners []string // Owners of the instances over the threshold
+}
+
+// UptimeDimension is the groups of one dimension, those with most instances over the
+// threshold first
+type UptimeDimension struct {
+	Field  string
+	Label  string
+	Groups []UptimeGroup
+}
+
+// UptimeReport groups running instances by service, owner and account to find those that
+// are never restarted
+type UptimeReport struct {
+	ThresholdDays int
+	Fleet         UptimeTrend
+	Dimensions    []UptimeDimension
+	OverThreshold []models.EC2Instance // Longest uptime first
+	UnknownUptime int                  // Running instances without a known uptime
+}
+
+// BuildUptimeReport reports on the running instances, comparing with the instances of an
+// earlier snapshot if previous is not nil
+func BuildUptimeReport(instances, previous []models.EC2Instance, thresholdDays int) UptimeReport {
+	report := UptimeReport{ThresholdDays: thresholdDays}
+	current := make(map[string]float64)
+	var running []models.EC2Instance
+	for _, instance := range instances {
+		if !instance.IsRunning() {
+			continue
+		}
+		days, known := uptimeDays(instance)
+		if !known {
+			report.UnknownUptime++
+			continue
+		}
+		current[instance.ID] = days
+		running = append(running, instance)
+		if days > float64(thresholdDays) {
+			report.OverThreshold = append(report.OverThreshold, instance)
+		}
+	}
+	sort.SliceStable(report.OverThreshold, func(i, j int) bool {
+		return current[report.OverThreshold[i].ID] > current[report.OverThreshold[j].ID]
+	})
+
+	report.Fleet = UptimeTrend{Current: uptimeStats(running, thresholdDays)}
+	if previous != nil {
+		stats := uptimeStats(previous, thresholdDays)
+		report.Fleet.Previous = &stats
+	}
+
+	for _, dimension := range UptimeReportDimensions {
+		grouped := groupInstances(running, dimension.Field)
+		var previousGroups map[string][]models.EC2Instance
+		if previous != nil {
+			previousGroups = groupInstances(previous, dimension.Field)
+		}
+
+		reportDimension := UptimeDimension{Field: dimension.Field, Label: dimension.Label}
+		for name, members := range grouped {
+			group := UptimeGroup{Name: name, Trend: UptimeTrend{Current: uptimeStats(members, thresholdDays)}}
+			if before, existed := previousGroups[name]; existed {
+				stats := uptimeStats(before, thresholdDays)
+				group.Trend.Previous = &stats
+			}
+			var owners []string
+			for _, instance := range members {
+				if days, _ := uptimeDays(instance); days > float64(thresholdDays) && instance.Owner != "" && !contains(owners, instance.Owner) {
+					owners = append(owners, instance.Owner)
+				}
+			}
+			sort.Strings(owners)
+			group.Owners = owners
+			reportDimension.Groups = append(reportDimension.Groups, group)
+		}
+		sort.Slice(reportDimension.Groups, func(i, j int) bool {
+			a, b := reportDimension.Groups[i].Trend.Current, reportDimension.Groups[j].Trend.Current
+			if a.OverThreshold != b.OverThreshold {
+				return a.OverThreshold > b.OverThreshold
+			}
+			if a.P90 != b.P90 {
+				return a.P90 > b.P90
+			}
+			return reportDimension.Groups[i].Name < reportDimension.Groups[j].Name
+		})
+		report.Dimensions = append(report.Dimensions, reportDimension)
+	}
+	return report
+}
+
+// uptimeDays returns the uptime of an instance in days, if known, read like the
+// min_uptime_days filter that the report links to
+func uptimeDays(instance models.EC2Instance) (float64, bool) {
+	return instance.Uptime()
+}
+
+// groupInstances groups instances by the value of a field; an empty value is its own group
+func groupInstances(instances []models.EC2Instance, field string) map[string][]models.EC2Instance {
+	groups := make(map[string][]models.EC2Instance)
+	for _, instance := range instances {
+		name := instance.Field(field)
+		groups[name] = append(groups[name], instance)
+	}
+	return groups
+}
+
+// uptimeStats computes the uptime percentiles of instances with a known uptime, in whole days
+func uptimeStats(instances []models.EC2Instance, thresholdDays int) UptimeStats {
+	var days []float64
+	for _, instance := range instances {
+		if value, known := uptimeDays(instance); known {
+			days = append(days, value)
+		}
+	}
+	stats := UptimeStats{Instances: len(days)}
+	if len(days) == 0 {
+		return stats
+	}
+	sort.Float64s(days)
+	stats.P50 = int(percentile(days, 50))
+	stats.P90 = int(percentile(days, 90))
+	stats.Max = int(days[len(days)-1])
+	for _, value := range days {
+		if value > float64(thresholdDays) {
+			stats.OverThreshold++
+		}
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
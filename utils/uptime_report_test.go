@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"ec2-restart-manager/models"
+)
+
+// memorySnapshotStore keeps uptime snapshots in memory
+type memorySnapshotStore struct {
+	snapshots []*models.UptimeSnapshot
+}
+
+func (s *memorySnapshotStore) SaveUptimeSnapshot(snapshot *models.UptimeSnapshot) error {
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+func (s *memorySnapshotStore) ListUptimeSnapshots() ([]*models.UptimeSnapshot, error) {
+	return s.snapshots, nil
+}
+
+func (s *memorySnapshotStore) DeleteUptimeSnapshotsBefore(string) error {
+	return nil
+}
+
+func TestFilteredUptimeReportAgainstSnapshot(t *testing.T) {
+	instances := []models.EC2Instance{
+		{
+			ID: "i-a", EC2Name: "web-1", Service: "payments", Owner: "team-a", AWSAccountName: "prod",
+			AWSAccountNumber: "111111111111", Region: "eu-west-1", EnvironmentClass: "prod", Source: "ec2",
+			State: "running", UptimeDays: "100", Tags: map[string]string{"Platform": "linux"},
+		},
+		{
+			ID: "i-b", EC2Name: "web-2", Service: "payments", Owner: "team-a", AWSAccountName: "prod",
+			AWSAccountNumber: "111111111111", Region: "us-east-1", EnvironmentClass: "prod", Source: "ec2",
+			State: "running", UptimeDays: "20", Tags: map[string]string{"Platform": "windows"},
+		},
+	}
+	store := &memorySnapshotStore{}
+	models.InjectUptimeSnapshotStore(store)
+	t.Cleanup(func() { models.InjectUptimeSnapshotStore(nil) })
+	models.LoadInstances(instances, "test", "")
+	now := time.Now()
+	if err := models.RecordUptimeSnapshot(now.AddDate(0, 0, -7)); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := models.FindUptimeSnapshot(now, 7)
+	if err != nil || snapshot == nil {
+		t.Fatalf("snapshot not found: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  int // Instances in both the current and the previous fleet
+	}{
+		{"", 2},
+		{"region=eu-west-1", 1},
+		{"tag:Platform=windows", 1},
+		{"q=linux", 1},
+		{"q=web", 2},
+		{"query=account_id%3D111111111111+AND+source%3Dec2", 2},
+		{"query=region%3Dap-south-1", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filter, err := ParseInstanceFilter(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// As in the report handler, an empty previous fleet still has a trend
+			previous := FilterInstances(snapshot.EC2Instances(), filter)
+			if previous == nil {
+				previous = []models.EC2Instance{}
+			}
+			report := BuildUptimeReport(FilterInstances(instances, filter), previous, 30)
+			if report.Fleet.Current.Instances != test.want {
+				t.Fatalf("%d current instances, want %d", report.Fleet.Current.Instances, test.want)
+			}
+			if report.Fleet.Previous == nil || report.Fleet.Previous.Instances != test.want {
+				t.Errorf("previous fleet %+v, want %d instances", report.Fleet.Previous, test.want)
+			}
+			for _, dimension := range report.Dimensions {
+				for _, group := range dimension.Groups {
+					if group.Trend.Previous == nil {
+						t.Errorf("%s group %q is missing from the snapshot", dimension.Field, group.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestOverThresholdMatchesFilter checks that the instances the report counts over the
+// threshold are those its min_uptime_days link lists, including decimal uptimes
+func TestOverThresholdMatchesFilter(t *testing.T) {
+	instances := []models.EC2Instance{
+		{ID: "i-a", UptimeDays: "30"},
+		{ID: "i-b", UptimeDays: "30.5"},
+		{ID: "i-c", UptimeDays: " 45 "},
+		{ID: "i-d", UptimeDays: "unknown"},
+	}
+	report := BuildUptimeReport(instances, nil, 30)
+	filter, err := ParseInstanceFilter(url.Values{"min_uptime_days": {"30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := matchingIDs(FilterInstances(instances, filter))
+	if counted := matchingIDs(report.OverThreshold); counted != "i-c,i-b" || listed != "i-b,i-c" {
+		t.Errorf("report counted %q, filter listed %q", counted, listed)
+	}
+	if report.Fleet.Current.OverThreshold != 2 || report.UnknownUptime != 1 {
+		t.Errorf("unexpected fleet stats %+v, %d unknown", report.Fleet.Current, report.UnknownUptime)
+	}
+}